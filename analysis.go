@@ -0,0 +1,662 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+type shadowRow struct {
+	Firewall   string `json:"firewall"`
+	Number     int    `json:"number"`
+	ShadowedBy int    `json:"shadowed_by"`
+	Action     string `json:"action"`
+}
+
+func expandAll(uids []string, allObjects map[string]*checkpoint.Node) (expanded map[string]bool, any bool) {
+	expanded = make(map[string]bool)
+	for _, uid := range uids {
+		n := checkpoint.Lookup(allObjects, uid)
+		if checkpoint.IsAnyObject(n) {
+			any = true
+		}
+
+		checkpoint.ExpandMembers(n, allObjects, expanded)
+	}
+
+	return
+}
+
+// Set of uids b is covered by set a if a contains any or every uid of b was reached expanding a
+func covers(a []string, b []string, allObjects map[string]*checkpoint.Node) bool {
+	expanded, any := expandAll(a, allObjects)
+	if any {
+		return true
+	}
+
+	for _, uid := range b {
+		if !expanded[uid] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Time and install on of rule a apply whenever and wherever b's do, either a is unrestricted or both name the same objects
+func refsCover(a []string, b []string, allObjects map[string]*checkpoint.Node) bool {
+	restriction := canonicalRefs(a, allObjects)
+	return restriction == "" || restriction == canonicalRefs(b, allObjects)
+}
+
+func findShadowed(rules []checkpoint.ACLRule, allObjects map[string]*checkpoint.Node) (shadowed []shadowRow) {
+	sorted := make([]checkpoint.ACLRule, len(rules))
+	copy(sorted, rules)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Firewall != sorted[j].Firewall {
+			return sorted[i].Firewall < sorted[j].Firewall
+		}
+		return sorted[i].Number < sorted[j].Number
+	})
+
+	shadowed = []shadowRow{}
+	for i, later := range sorted {
+		//Negated sets are complements, subset checks on them would need the whole object space
+		if later.SrcNegate || later.DstNegate || later.ServiceNegate {
+			continue
+		}
+
+		for _, earlier := range sorted[:i] {
+			if earlier.Firewall != later.Firewall || earlier.Layer != later.Layer || earlier.Action != later.Action || earlier.SrcNegate || earlier.DstNegate || earlier.ServiceNegate {
+				continue
+			}
+
+			if refsCover(earlier.Time, later.Time, allObjects) &&
+				refsCover(earlier.InstallOn, later.InstallOn, allObjects) &&
+				covers(earlier.Source, later.Source, allObjects) &&
+				covers(earlier.Destination, later.Destination, allObjects) &&
+				covers(earlier.Service, later.Service, allObjects) {
+
+				shadowed = append(shadowed, shadowRow{
+					Firewall:   later.Firewall,
+					Number:     later.Number,
+					ShadowedBy: earlier.Number,
+					Action:     checkpoint.Lookup(allObjects, later.Action).Name,
+				})
+				break
+			}
+		}
+	}
+
+	return
+}
+
+func printShadowed(rows []shadowRow, format string) {
+	s := section{Key: "shadowed", Title: "Shadowed rules", Headers: []string{"Firewall", "No.", "Shadowed By", "Action"}}
+	for _, row := range rows {
+		s.Rows = append(s.Rows, [][]string{cell(row.Firewall), cell(fmt.Sprintf("%d", row.Number)), cell(fmt.Sprintf("%d", row.ShadowedBy)), cell(row.Action)})
+	}
+
+	printSection(format, s, rows)
+}
+
+type redundantRow struct {
+	Firewall string `json:"firewall"`
+	Layer    string `json:"layer"`
+	Numbers  []int  `json:"numbers"`
+	Action   string `json:"action"`
+}
+
+// Objects a side reaches once groups are flattened, so the same objects listed directly or through a group compare equal
+func canonicalSide(uids []string, negate bool, allObjects map[string]*checkpoint.Node) string {
+	expanded, any := expandAll(uids, allObjects)
+	if any {
+		return fmt.Sprintf("any|%v", negate)
+	}
+
+	var leaves []string
+	for key := range expanded {
+		switch checkpoint.Lookup(allObjects, key).Type {
+		//Groups with exclusion stay in, their members alone don't say what they match
+		case "group", "service-group":
+			continue
+		}
+		leaves = append(leaves, key)
+	}
+	sort.Strings(leaves)
+
+	return fmt.Sprintf("%s|%v", strings.Join(leaves, ","), negate)
+}
+
+// Time and install on objects aren't expanded, listing them in a different order is still the same rule
+func canonicalRefs(uids []string, allObjects map[string]*checkpoint.Node) string {
+	var refs []string
+	for _, uid := range uids {
+		if n := checkpoint.Lookup(allObjects, uid); !checkpoint.IsAnyObject(n) {
+			refs = append(refs, n.Key())
+		}
+	}
+	sort.Strings(refs)
+
+	return strings.Join(refs, ",")
+}
+
+// Rules in the same layer with the same action, expanded source, destination and service, time and install on. All but the first can go
+func findRedundant(rules []checkpoint.ACLRule, allObjects map[string]*checkpoint.Node) (redundant []redundantRow) {
+	groups := make(map[string]int)
+
+	redundant = []redundantRow{}
+	for _, acl := range rules {
+		hash := fmt.Sprintf("%x", md5.Sum([]byte(strings.Join([]string{
+			acl.Firewall, acl.Layer, acl.Action,
+			canonicalSide(acl.Source, acl.SrcNegate, allObjects),
+			canonicalSide(acl.Destination, acl.DstNegate, allObjects),
+			canonicalSide(acl.Service, acl.ServiceNegate, allObjects),
+			canonicalRefs(acl.Time, allObjects),
+			canonicalRefs(acl.InstallOn, allObjects),
+		}, "\n"))))
+
+		if i, ok := groups[hash]; ok {
+			redundant[i].Numbers = append(redundant[i].Numbers, acl.Number)
+			continue
+		}
+
+		groups[hash] = len(redundant)
+		redundant = append(redundant, redundantRow{
+			Firewall: acl.Firewall,
+			Layer:    layerName(acl, allObjects),
+			Numbers:  []int{acl.Number},
+			Action:   checkpoint.Lookup(allObjects, acl.Action).Name,
+		})
+	}
+
+	//Only groups with more than one rule are redundant
+	duplicated := []redundantRow{}
+	for _, row := range redundant {
+		if len(row.Numbers) > 1 {
+			duplicated = append(duplicated, row)
+		}
+	}
+
+	return duplicated
+}
+
+func printRedundant(rows []redundantRow, format string) {
+	s := section{Key: "redundant", Title: "Redundant rules", Headers: []string{"Firewall", "Layer", "Rules", "Action"}}
+	for _, row := range rows {
+		var numbers []string
+		for _, n := range row.Numbers {
+			numbers = append(numbers, fmt.Sprintf("%d", n))
+		}
+
+		s.Rows = append(s.Rows, [][]string{cell(row.Firewall), cell(row.Layer), cell(strings.Join(numbers, ", ")), cell(row.Action)})
+	}
+
+	printSection(format, s, rows)
+}
+
+type unusedRow struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	UID      string `json:"uid"`
+	Modified string `json:"modified,omitempty"`
+}
+
+// Date the object was changed if that was after since, empty when it wasn't or since is unset
+func modifiedAfter(n *checkpoint.Node, since time.Time) string {
+	if since.IsZero() || !n.Modified.After(since) {
+		return ""
+	}
+
+	return n.Modified.Format("2006-01-02 15:04")
+}
+
+func expandGroups(n *checkpoint.Node, allObjects map[string]*checkpoint.Node, referenced map[string]bool) {
+	if referenced[n.Key()] {
+		return
+	}
+	referenced[n.Key()] = true
+
+	for _, e := range n.Edges {
+		if e.Start == n && e.Method == "Mono" {
+			expandGroups(e.End, allObjects, referenced)
+		}
+	}
+
+	//The except group isn't a member but is still in use
+	if except, ok := allObjects[string(n.Except)]; ok && n.Type == "group-with-exclusion" {
+		expandGroups(except, allObjects, referenced)
+	}
+}
+
+// Only objects with tag are listed when it is set
+func findUnused(rules []checkpoint.ACLRule, allObjects map[string]*checkpoint.Node, since time.Time, tag string) (unused []unusedRow) {
+	referenced := make(map[string]bool)
+	for _, acl := range rules {
+		for _, uids := range [][]string{acl.Source, acl.Destination, acl.Service} {
+			for _, uid := range uids {
+				if n, ok := allObjects[uid]; ok {
+					expandGroups(n, allObjects, referenced)
+				}
+			}
+		}
+	}
+
+	unused = []unusedRow{}
+	for key, n := range allObjects {
+		if tag != "" && !n.HasTag(tag) {
+			continue
+		}
+
+		switch n.Type {
+		case "host", "network", "address-range", "group", "group-with-exclusion":
+			if !referenced[key] {
+				unused = append(unused, unusedRow{Name: n.Name, Type: n.Type, UID: n.Uid, Modified: modifiedAfter(n, since)})
+			}
+		}
+	}
+
+	sort.Slice(unused, func(i, j int) bool {
+		if unused[i].Type != unused[j].Type {
+			return unused[i].Type < unused[j].Type
+		}
+		return unused[i].Name < unused[j].Name
+	})
+
+	return
+}
+
+func printUnused(rows []unusedRow, format string, showModified bool) {
+	s := section{Key: "unused", Title: "Unused objects", Headers: []string{"Name", "Type", "UID"}}
+	if showModified {
+		s.Headers = append(s.Headers, "Modified")
+	}
+	for _, row := range rows {
+		cells := [][]string{cell(row.Name), cell(row.Type), cell(row.UID)}
+		if showModified {
+			cells = append(cells, cell(row.Modified))
+		}
+		s.Rows = append(s.Rows, cells)
+	}
+
+	printSection(format, s, rows)
+}
+
+type tagMismatchRow struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	UID       string   `json:"uid"`
+	Tags      []string `json:"tags"`
+	Group     string   `json:"group"`
+	GroupTags []string `json:"group_tags"`
+}
+
+func tagNames(n *checkpoint.Node) (names []string) {
+	for _, t := range n.Tags {
+		names = append(names, string(t))
+	}
+	return
+}
+
+// Objects sharing no tag with a group they are in, e.g a host tagged dev in a group tagged prod. Untagged objects and groups aren't compared
+func findTagMismatches(allObjects map[string]*checkpoint.Node) (mismatches []tagMismatchRow) {
+	mismatches = []tagMismatchRow{}
+	for _, key := range sortedKeys(allObjects) {
+		n := allObjects[key]
+		if len(n.Tags) == 0 {
+			continue
+		}
+
+		for _, g := range checkpoint.MemberOf(n) {
+			if len(g.Tags) == 0 {
+				continue
+			}
+
+			shared := false
+			for _, t := range g.Tags {
+				shared = shared || n.HasTag(string(t))
+			}
+
+			if !shared {
+				mismatches = append(mismatches, tagMismatchRow{Name: n.Name, Type: n.Type, UID: n.Uid, Tags: tagNames(n), Group: g.Name, GroupTags: tagNames(g)})
+			}
+		}
+	}
+
+	return
+}
+
+func printTagMismatches(rows []tagMismatchRow, format string) {
+	s := section{Key: "tag_mismatches", Title: "Objects not sharing a tag with their groups", Headers: []string{"Name", "Type", "Tags", "Group", "Group Tags", "UID"}}
+	for _, row := range rows {
+		s.Rows = append(s.Rows, [][]string{cell(row.Name), cell(row.Type), row.Tags, cell(row.Group), row.GroupTags, cell(row.UID)})
+	}
+
+	printSection(format, s, rows)
+}
+
+type overlapRow struct {
+	Network   string `json:"network"`
+	CIDR      string `json:"cidr"`
+	Relation  string `json:"relation"`
+	Other     string `json:"other"`
+	OtherCIDR string `json:"other_cidr"`
+}
+
+func findOverlaps(allObjects map[string]*checkpoint.Node) (overlaps []overlapRow) {
+	type prefix struct{ ones, bits int }
+	type entry struct {
+		node     *checkpoint.Node
+		netRange *net.IPNet
+	}
+
+	buckets := make(map[prefix]map[string][]entry)
+	var entries []entry
+	var prefixes []prefix
+
+	for _, key := range sortedKeys(allObjects) {
+		n := allObjects[key]
+		if n.Type != "network" {
+			continue
+		}
+
+		for _, netRange := range n.Ranges() {
+			ones, bits := netRange.Mask.Size()
+			p := prefix{ones, bits}
+			if _, ok := buckets[p]; !ok {
+				buckets[p] = make(map[string][]entry)
+				prefixes = append(prefixes, p)
+			}
+
+			e := entry{n, netRange}
+			buckets[p][netRange.IP.String()] = append(buckets[p][netRange.IP.String()], e)
+			entries = append(entries, e)
+		}
+	}
+
+	sort.Slice(prefixes, func(i, j int) bool {
+		if prefixes[i].bits != prefixes[j].bits {
+			return prefixes[i].bits < prefixes[j].bits
+		}
+		return prefixes[i].ones < prefixes[j].ones
+	})
+
+	overlaps = []overlapRow{}
+	for _, inner := range entries {
+		ones, bits := inner.netRange.Mask.Size()
+
+		//Only equal or shorter prefixes can contain this network
+		for _, p := range prefixes {
+			if p.bits != bits || p.ones > ones {
+				continue
+			}
+
+			for _, outer := range buckets[p][inner.netRange.IP.Mask(net.CIDRMask(p.ones, p.bits)).String()] {
+				if outer.node == inner.node {
+					continue
+				}
+
+				relation := "contains"
+				if p.ones == ones {
+					//Identical pairs are found from both sides, only report them once
+					if outer.node.Key() > inner.node.Key() {
+						continue
+					}
+					relation = "identical to"
+				}
+
+				overlaps = append(overlaps, overlapRow{
+					Network:   outer.node.Name,
+					CIDR:      outer.netRange.String(),
+					Relation:  relation,
+					Other:     inner.node.Name,
+					OtherCIDR: inner.netRange.String(),
+				})
+			}
+		}
+	}
+
+	return
+}
+
+func printOverlaps(rows []overlapRow, format string) {
+	s := section{Key: "overlaps", Title: "Network overlaps", Headers: []string{"Network", "CIDR", "Relation", "Other", "Other CIDR"}}
+	for _, row := range rows {
+		s.Rows = append(s.Rows, [][]string{cell(row.Network), cell(row.CIDR), cell(row.Relation), cell(row.Other), cell(row.OtherCIDR)})
+	}
+
+	printSection(format, s, rows)
+}
+
+type malformedRow struct {
+	Name    string `json:"name"`
+	UID     string `json:"uid"`
+	Address string `json:"address"`
+	Problem string `json:"problem"`
+}
+
+func findMalformedHosts(allObjects map[string]*checkpoint.Node) (malformed []malformedRow) {
+	for _, key := range sortedKeys(allObjects) {
+		n := allObjects[key]
+		if n.Type != "host" {
+			continue
+		}
+
+		if n.IPv4 == "" && n.IPv6 == "" {
+			malformed = append(malformed, malformedRow{Name: n.Name, UID: n.Uid, Problem: "no address"})
+			continue
+		}
+
+		for _, address := range []string{n.IPv4, n.IPv6} {
+			if address != "" && net.ParseIP(address) == nil {
+				malformed = append(malformed, malformedRow{Name: n.Name, UID: n.Uid, Address: address, Problem: "malformed address"})
+			}
+		}
+	}
+
+	return
+}
+
+// Warnings go to stderr so they never end up in the report, nothing is printed without rows
+func warnSection(s section) {
+	if len(s.Rows) == 0 {
+		return
+	}
+
+	fprintTables(os.Stderr, []section{s})
+}
+
+func warnMalformedHosts(rows []malformedRow) {
+	s := section{Key: "malformed", Title: "Malformed hosts", Headers: []string{"Name", "UID", "Address", "Problem"}}
+	for _, row := range rows {
+		s.Rows = append(s.Rows, [][]string{cell(row.Name), cell(row.UID), cell(row.Address), cell(row.Problem)})
+	}
+
+	warnSection(s)
+}
+
+type problemRow struct {
+	Name    string `json:"name"`
+	UID     string `json:"uid"`
+	Type    string `json:"type"`
+	Problem string `json:"problem"`
+}
+
+func validateObjects(objectSets [][]json.RawMessage, domainFilter string) (problems []problemRow) {
+	objects := make(map[string]*checkpoint.Node)
+	var order []string
+
+	for i, jsonObjects := range objectSets {
+		for j, v := range jsonObjects {
+			var n checkpoint.Node
+			if err := json.Unmarshal(v, &n); err != nil {
+				problems = append(problems, problemRow{Problem: fmt.Sprintf("object %d in export %d does not parse: %s", j, i, err)})
+				continue
+			}
+
+			if !checkpoint.InDomain(n.Domain, domainFilter) {
+				continue
+			}
+
+			if _, ok := objects[n.Key()]; !ok {
+				order = append(order, n.Key())
+			}
+			objects[n.Key()] = &n
+		}
+	}
+
+	index := checkpoint.IndexByUid(objects)
+	names := checkpoint.NameIndex(objects)
+	for _, key := range order {
+		n := objects[key]
+		problem := func(format string, args ...interface{}) {
+			problems = append(problems, problemRow{Name: n.Name, UID: n.Uid, Type: n.Type, Problem: fmt.Sprintf(format, args...)})
+		}
+
+		switch n.Type {
+		case "group", "service-group":
+			for _, m := range n.Members {
+				if _, ok := checkpoint.ResolveMember(objects, index, names, n.Domain, m); !ok {
+					problem("member %s does not resolve by uid or name", m)
+				}
+			}
+		case "group-with-exclusion":
+			for _, ref := range []checkpoint.Reference{n.Include, n.Except} {
+				if _, ok := objects[checkpoint.ResolveRef(objects, index, n.Domain, string(ref))]; !ok {
+					problem("member %s does not resolve", ref)
+				}
+			}
+		case "network":
+			if n.SubnetAddress == "" && n.Subnet6 == "" {
+				problem("no subnet")
+			}
+			if _, err := n.ParseRanges(); err != nil {
+				problem("bad network: %s", err)
+			}
+		case "host":
+			for _, address := range []string{n.IPv4, n.IPv6} {
+				if address != "" && net.ParseIP(address) == nil {
+					problem("bad address %s", address)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+func printValidation(problems []problemRow, format string) {
+	if textFormat(format) && len(problems) == 0 {
+		fmt.Fprintln(out, "No problems found")
+		return
+	}
+
+	s := section{Key: "problems", Title: "Validation problems", Headers: []string{"Name", "UID", "Type", "Problem"}}
+	for _, p := range problems {
+		s.Rows = append(s.Rows, [][]string{cell(p.Name), cell(p.UID), cell(p.Type), cell(p.Problem)})
+	}
+
+	if problems == nil {
+		problems = []problemRow{}
+	}
+	printSection(format, s, problems)
+}
+
+type cycleRow struct {
+	Cycle []string `json:"cycle"`
+	UIDs  []string `json:"uids"`
+}
+
+// Groups can contain each other, each cycle is reported once starting from its smallest key
+func findCycles(allObjects map[string]*checkpoint.Node) (cycles []cycleRow) {
+	const (
+		unvisited = iota
+		onStack
+		done
+	)
+
+	state := make(map[string]int)
+	seen := make(map[string]bool)
+	var stack []string
+
+	var visit func(key string)
+	visit = func(key string) {
+		n, ok := allObjects[key]
+		if !ok {
+			return
+		}
+
+		state[key] = onStack
+		stack = append(stack, key)
+
+		members := n.Members
+		if n.Type == "group-with-exclusion" {
+			members = []string{string(n.Include), string(n.Except)}
+		}
+
+		for _, m := range members {
+			switch state[m] {
+			case unvisited:
+				visit(m)
+			case onStack:
+				var cycle []string
+				for i := len(stack) - 1; i >= 0; i-- {
+					cycle = append([]string{stack[i]}, cycle...)
+					if stack[i] == m {
+						break
+					}
+				}
+
+				//Rotate so the same cycle found from another member looks the same
+				start := 0
+				for i := range cycle {
+					if cycle[i] < cycle[start] {
+						start = i
+					}
+				}
+				cycle = append(cycle[start:], cycle[:start]...)
+
+				id := strings.Join(cycle, " ")
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+
+				row := cycleRow{}
+				for _, c := range append(cycle, cycle[0]) {
+					row.Cycle = append(row.Cycle, allObjects[c].Name)
+					row.UIDs = append(row.UIDs, allObjects[c].Uid)
+				}
+				cycles = append(cycles, row)
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[key] = done
+	}
+
+	for _, key := range sortedKeys(allObjects) {
+		if state[key] == unvisited {
+			visit(key)
+		}
+	}
+
+	return
+}
+
+func warnCycles(rows []cycleRow) {
+	s := section{Key: "cycles", Title: "Membership cycles", Headers: []string{"Cycle", "UIDs"}}
+	for _, row := range rows {
+		s.Rows = append(s.Rows, [][]string{cell(strings.Join(row.Cycle, " -> ")), cell(strings.Join(row.UIDs, " -> "))})
+	}
+
+	warnSection(s)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+const testExport = `[
+	{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+	{"uid": "h2", "name": "web2", "type": "host", "ipv4-address": "10.0.0.2"},
+	{"uid": "h3", "name": "db1", "type": "host", "ipv4-address": "10.0.1.1"},
+	{"uid": "n1", "name": "net-web", "type": "network", "subnet4": "10.0.0.0", "mask-length4": 24},
+	{"uid": "g1", "name": "webs", "type": "group", "members": ["h1", "h2"]},
+	{"uid": "g2", "name": "only2", "type": "group", "members": ["h2"]},
+	{"uid": "x1", "name": "webs-but-2", "type": "group-with-exclusion", "include": "g1", "except": "g2"},
+	{"uid": "s1", "name": "https", "type": "service-tcp", "port": "443"},
+	{"uid": "t1", "name": "bizhours", "type": "time"},
+	{"uid": "fw", "name": "gw1", "type": "simple-gateway"},
+	{"uid": "acc", "name": "Accept", "type": "RulebaseAction"},
+	{"uid": "drop", "name": "Drop", "type": "RulebaseAction"},
+	{"uid": "any", "name": "Any", "type": "CpmiAnyObject"}
+]`
+
+// Hand written export loaded through the checkpoint package, the way main loads a real one
+func testObjects(t *testing.T, export string) map[string]*checkpoint.Node {
+	t.Helper()
+
+	objects, err := checkpoint.LoadObjects(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkpoint.BuildGraph(objects, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return objects
+}
+
+// Enabled accept rule on fw1 from src to dst, Any where a side is empty
+func testRule(number int, src, dst, service string) checkpoint.ACLRule {
+	side := func(uid string) []string {
+		if uid == "" {
+			uid = "any"
+		}
+		return []string{uid}
+	}
+
+	return checkpoint.ACLRule{
+		Firewall:    "fw1",
+		Type:        "access-rule",
+		Action:      "acc",
+		Enabled:     true,
+		Number:      number,
+		Source:      side(src),
+		Destination: side(dst),
+		Service:     side(service),
+		Time:        side(""),
+		InstallOn:   side(""),
+	}
+}
+
+func shadowedBy(rows []shadowRow) map[int]int {
+	found := make(map[int]int)
+	for _, row := range rows {
+		found[row.Number] = row.ShadowedBy
+	}
+
+	return found
+}
+
+func TestFindShadowedExclusion(t *testing.T) {
+	objects := testObjects(t, testExport)
+
+	rules := []checkpoint.ACLRule{
+		testRule(1, "x1", "h3", ""),
+		testRule(2, "h2", "h3", ""),
+		testRule(3, "h1", "h3", ""),
+		//The include group has the excepted host in it
+		testRule(4, "g1", "h3", ""),
+	}
+
+	found := shadowedBy(findShadowed(rules, objects))
+	if found[3] != 1 {
+		t.Errorf("Rule 3 should be shadowed by 1, got %v", found)
+	}
+
+	for _, number := range []int{2, 4} {
+		if by, ok := found[number]; ok {
+			t.Errorf("Rule %d reaches the excepted web2 and shouldn't be shadowed, got shadowed by %d", number, by)
+		}
+	}
+}
+
+func TestFindShadowedTimeAndInstallOn(t *testing.T) {
+	objects := testObjects(t, testExport)
+
+	restricted := testRule(1, "h1", "h3", "")
+	restricted.Time = []string{"t1"}
+
+	installed := testRule(2, "h1", "h3", "")
+	installed.InstallOn = []string{"fw"}
+
+	sameTime := testRule(4, "h1", "h3", "")
+	sameTime.Time = []string{"t1"}
+
+	rules := []checkpoint.ACLRule{restricted, installed, testRule(3, "h1", "h3", ""), sameTime}
+
+	found := shadowedBy(findShadowed(rules, objects))
+	if by, ok := found[3]; ok {
+		t.Errorf("Rule 3 applies always and everywhere, it shouldn't be shadowed but is by %d", by)
+	}
+
+	if by, ok := found[2]; ok {
+		t.Errorf("Rule 2 applies always, it shouldn't be shadowed but is by %d", by)
+	}
+
+	if found[4] != 1 {
+		t.Errorf("Rule 4 has the same time as rule 1 and should be shadowed by it, got %v", found)
+	}
+}
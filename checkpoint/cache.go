@@ -0,0 +1,53 @@
+package checkpoint
+
+import "sync"
+
+type associationKey struct {
+	n        *Node
+	maxDepth int
+	strict   bool
+}
+
+type associations struct {
+	assoc   []*Node
+	parents map[*Node]*Node
+}
+
+// Remembers PermissionGroups results, so auditing the same object again (e.g from several targets or an interactive session) doesn't walk the graph again.
+// The graph doesn't change once built so nothing is ever invalidated. Results are shared and must not be modified, it is safe to use from several goroutines
+type AssociationCache struct {
+	mu      sync.Mutex
+	entries map[associationKey]associations
+}
+
+func NewAssociationCache() *AssociationCache {
+	return &AssociationCache{entries: make(map[associationKey]associations)}
+}
+
+func (c *AssociationCache) PermissionGroups(n *Node, maxDepth int) (assoc []*Node, parents map[*Node]*Node) {
+	return c.lookup(n, maxDepth, false)
+}
+
+func (c *AssociationCache) StrictPermissionGroups(n *Node, maxDepth int) (assoc []*Node, parents map[*Node]*Node) {
+	return c.lookup(n, maxDepth, true)
+}
+
+func (c *AssociationCache) lookup(n *Node, maxDepth int, strict bool) ([]*Node, map[*Node]*Node) {
+	key := associationKey{n: n, maxDepth: maxDepth, strict: strict}
+
+	c.mu.Lock()
+	cached, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return cached.assoc, cached.parents
+	}
+
+	//Computed outside the lock so other targets aren't held up, two workers may both compute the same one
+	assoc, parents := permissionGroupsOf(n, maxDepth, strict)
+
+	c.mu.Lock()
+	c.entries[key] = associations{assoc: assoc, parents: parents}
+	c.mu.Unlock()
+
+	return assoc, parents
+}
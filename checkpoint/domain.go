@@ -0,0 +1,132 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Multi-Domain Server objects and rules carry their domain, exports have it either as a name or as a domain object
+type DomainName string
+
+func (d *DomainName) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*d = DomainName(name)
+		return nil
+	}
+
+	var domain struct {
+		Name string
+	}
+	if err := json.Unmarshal(b, &domain); err != nil {
+		return err
+	}
+
+	*d = DomainName(domain.Name)
+	return nil
+}
+
+// References to a single object are its uid, or the object itself in exports with a higher details level
+type Reference string
+
+func (r *Reference) UnmarshalJSON(b []byte) error {
+	var uid string
+	if err := json.Unmarshal(b, &uid); err == nil {
+		*r = Reference(uid)
+		return nil
+	}
+
+	var object struct {
+		Uid string
+	}
+	if err := json.Unmarshal(b, &object); err != nil {
+		return err
+	}
+
+	*r = Reference(object.Uid)
+	return nil
+}
+
+// UIDs can collide across domains, so objects are keyed by both. Objects without a domain keep their plain uid
+func ObjectKey(domain DomainName, uid string) string {
+	if domain == "" {
+		return uid
+	}
+
+	return string(domain) + ":" + uid
+}
+
+func (n *Node) Key() string {
+	return ObjectKey(n.Domain, n.Uid)
+}
+
+func IndexByUid(objects map[string]*Node) map[string][]string {
+	index := make(map[string][]string)
+	for key, n := range objects {
+		index[n.Uid] = append(index[n.Uid], key)
+	}
+
+	for uid := range index {
+		sort.Strings(index[uid])
+	}
+
+	return index
+}
+
+// References are plain uids, prefer the referencing domain and fall back to wherever else the uid was defined (e.g Global)
+func ResolveRef(objects map[string]*Node, index map[string][]string, domain DomainName, uid string) string {
+	if _, ok := objects[ObjectKey(domain, uid)]; ok {
+		return ObjectKey(domain, uid)
+	}
+
+	if keys := index[uid]; len(keys) != 0 {
+		if len(keys) == 1 {
+			return keys[0]
+		}
+
+		for _, key := range keys {
+			if strings.EqualFold(string(objects[key].Domain), "Global") {
+				return key
+			}
+		}
+
+		return keys[0]
+	}
+
+	return uid
+}
+
+func ResolveRefs(objects map[string]*Node, index map[string][]string, domain DomainName, uids []string) []string {
+	resolved := make([]string, len(uids))
+	for i, uid := range uids {
+		resolved[i] = ResolveRef(objects, index, domain, uid)
+	}
+
+	return resolved
+}
+
+// Group members are uids, but older and hand edited exports list names instead. A name shared by several objects only resolves to the one in the group's domain
+func ResolveMember(objects map[string]*Node, index, names map[string][]string, domain DomainName, member string) (string, bool) {
+	if key := ResolveRef(objects, index, domain, member); objects[key] != nil {
+		return key, true
+	}
+
+	keys := names[member]
+	for _, key := range keys {
+		if objects[key].Domain == domain {
+			return key, true
+		}
+	}
+
+	if len(keys) == 1 {
+		return keys[0], true
+	}
+
+	return member, false
+}
+
+// Domains inherit from Global, so its objects stay visible when auditing a single domain
+func InDomain(domain DomainName, filter string) bool {
+	return filter == "" || strings.EqualFold(string(domain), filter) || strings.EqualFold(string(domain), "Global")
+}
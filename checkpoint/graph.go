@@ -0,0 +1,250 @@
+package checkpoint
+
+// Everything the object covers, groups by their members and networks/address ranges by the hosts they contain.
+// A group with exclusion covers what its include group does less anything overlapping its except group
+func ExpandMembers(n *Node, objects map[string]*Node, expanded map[string]bool) {
+	expandMembers(n, objects, expanded, make(map[*Node]bool))
+}
+
+func expandMembers(n *Node, objects map[string]*Node, expanded map[string]bool, excluding map[*Node]bool) {
+	if expanded[n.Key()] {
+		return
+	}
+	expanded[n.Key()] = true
+
+	if n.Type == "group-with-exclusion" {
+		//Cyclic exclusions cover nothing more than themselves
+		if excluding[n] {
+			return
+		}
+		excluding[n] = true
+		defer delete(excluding, n)
+
+		include, except := map[string]bool{n.Key(): true}, map[string]bool{n.Key(): true}
+		if g, ok := objects[string(n.Include)]; ok {
+			expandMembers(g, objects, include, excluding)
+		}
+		if g, ok := objects[string(n.Except)]; ok {
+			expandMembers(g, objects, except, excluding)
+		}
+		delete(except, n.Key())
+
+		//Groups and networks are only covered whole if nothing under them is excepted
+		for key := range include {
+			if except[key] || expanded[key] {
+				continue
+			}
+
+			if m, ok := objects[key]; ok {
+				members := make(map[string]bool)
+				expandMembers(m, objects, members, excluding)
+				if overlaps(members, except) {
+					continue
+				}
+			}
+
+			expanded[key] = true
+		}
+
+		return
+	}
+
+	for _, e := range n.Edges {
+		if e.Start != n {
+			continue
+		}
+
+		switch e.Method {
+		case "Mono":
+			expandMembers(e.End, objects, expanded, excluding)
+		case "Di":
+			if n.Type == "network" || n.Type == "address-range" {
+				expandMembers(e.End, objects, expanded, excluding)
+			}
+		}
+	}
+}
+
+func overlaps(a, b map[string]bool) bool {
+	for key := range a {
+		if b[key] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Breadth first search state, depth is the hops from the start and doubles as the visited set
+type walk struct {
+	depth   map[*Node]int
+	parents map[*Node]*Node
+	queue   []*Node
+}
+
+func newWalk(start *Node) *walk {
+	return &walk{depth: map[*Node]int{start: 0}, parents: map[*Node]*Node{start: nil}, queue: []*Node{start}}
+}
+
+// Queues next one hop further than from, unless it was reached already
+func (w *walk) push(next, from *Node) {
+	if _, visited := w.depth[next]; visited {
+		return
+	}
+
+	w.depth[next] = w.depth[from] + 1
+	w.parents[next] = from
+	w.queue = append(w.queue, next)
+}
+
+func (w *walk) pop() *Node {
+	n := w.queue[0]
+	w.queue = w.queue[1:]
+	return n
+}
+
+// Everything reachable from n towards its members. A negative maxDepth means the search is unbounded
+func AllChildren(n *Node, maxDepth int) (children []*Node, parents map[*Node]*Node) {
+	w := newWalk(n)
+
+	for len(w.queue) != 0 {
+		currentNode := w.pop()
+		children = append(children, currentNode)
+
+		if maxDepth >= 0 && w.depth[currentNode] >= maxDepth {
+			continue
+		}
+
+		for _, e := range currentNode.Edges {
+			w.push(e.End, currentNode)
+		}
+	}
+
+	return children, w.parents
+}
+
+// Groups, networks and address ranges n belongs to, with the node each was reached from. A negative maxDepth means the search is unbounded
+func PermissionGroups(n *Node, maxDepth int) (assoc []*Node, parents map[*Node]*Node) {
+	return permissionGroupsOf(n, maxDepth, false)
+}
+
+// PermissionGroups, but a host only starts from the most specific network containing it rather than every supernet as well
+func StrictPermissionGroups(n *Node, maxDepth int) (assoc []*Node, parents map[*Node]*Node) {
+	return permissionGroupsOf(n, maxDepth, true)
+}
+
+func permissionGroupsOf(n *Node, maxDepth int, strict bool) (assoc []*Node, parents map[*Node]*Node) {
+	//Everything n is in regardless of exclusions, a group with exclusion doesn't contain n if its except group does
+	all, _ := permissionGroups(n, -1, strict, nil)
+	belongs := make(map[string]bool)
+	for _, a := range all {
+		belongs[a.Key()] = true
+	}
+
+	return permissionGroups(n, maxDepth, strict, func(g *Node) bool {
+		return g.Type == "group-with-exclusion" && belongs[string(g.Except)]
+	})
+}
+
+// Longest prefix networks containing each of the host's addresses, equally specific networks are all kept
+func mostSpecificNetworks(host *Node) map[*Node]bool {
+	keep := make(map[*Node]bool)
+	for _, ip := range host.Addresses() {
+		longest := -1
+		var best []*Node
+		for _, e := range host.Edges {
+			if e.End.Type != "network" {
+				continue
+			}
+
+			for _, r := range e.End.Ranges() {
+				ones, _ := r.Mask.Size()
+				if !r.Contains(ip) || ones < longest {
+					continue
+				}
+
+				if ones > longest {
+					longest, best = ones, nil
+				}
+				best = append(best, e.End)
+			}
+		}
+
+		for _, b := range best {
+			keep[b] = true
+		}
+	}
+
+	return keep
+}
+
+func permissionGroups(n *Node, maxDepth int, strict bool, excluded func(*Node) bool) (assoc []*Node, parents map[*Node]*Node) {
+	w := newWalk(n)
+
+	var specific map[*Node]bool
+	if strict && n.Type == "host" {
+		specific = mostSpecificNetworks(n)
+	}
+
+	//Only add directly connected networks, address ranges and hosts
+	for _, e := range n.Edges {
+		if maxDepth == 0 {
+			break
+		}
+
+		if specific != nil && e.End.Type == "network" && !specific[e.End] {
+			continue
+		}
+
+		if e.End.Type == "network" || e.End.Type == "address-range" || e.End.Type == "host" {
+			w.push(e.End, n)
+		}
+	}
+
+	for len(w.queue) != 0 {
+		currentNode := w.pop()
+		assoc = append(assoc, currentNode)
+
+		if maxDepth >= 0 && w.depth[currentNode] >= maxDepth {
+			continue
+		}
+
+		//Hosts reached through a network don't make the network part of their groups, only the target's own groups count
+		if currentNode.Type == "host" && currentNode != n {
+			continue
+		}
+
+		for _, e := range currentNode.Edges {
+			if excluded != nil && excluded(e.Start) {
+				continue
+			}
+
+			w.push(e.Start, currentNode)
+		}
+	}
+
+	return assoc, w.parents
+}
+
+// Groups n is a member of, directly or through other groups, nearest first
+func MemberOf(n *Node) (groups []*Node) {
+	visited := map[*Node]bool{n: true}
+	searchSpace := []*Node{n}
+
+	for len(searchSpace) != 0 {
+		currentNode := searchSpace[0]
+		searchSpace = searchSpace[1:]
+
+		for _, e := range currentNode.Edges {
+			if e.Method != "Mono" || e.End != currentNode || visited[e.Start] {
+				continue
+			}
+
+			visited[e.Start] = true
+			groups = append(groups, e.Start)
+			searchSpace = append(searchSpace, e.Start)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,151 @@
+package checkpoint
+
+import (
+	"strings"
+	"testing"
+)
+
+// Objects of a hand written export, with the graph built
+func buildObjects(t *testing.T, export string) map[string]*Node {
+	t.Helper()
+
+	objects, err := LoadObjects(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := BuildGraph(objects, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return objects
+}
+
+func names(nodes []*Node) map[string]bool {
+	found := make(map[string]bool)
+	for _, n := range nodes {
+		found[n.Name] = true
+	}
+
+	return found
+}
+
+const exclusionExport = `[
+	{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+	{"uid": "h2", "name": "web2", "type": "host", "ipv4-address": "10.0.0.2"},
+	{"uid": "h3", "name": "db1", "type": "host", "ipv4-address": "10.0.1.1"},
+	{"uid": "n1", "name": "net-web", "type": "network", "subnet4": "10.0.0.0", "mask-length4": 24},
+	{"uid": "g1", "name": "webs", "type": "group", "members": ["h1", "h2"]},
+	{"uid": "g2", "name": "only2", "type": "group", "members": ["h2"]},
+	{"uid": "x1", "name": "webs-but-2", "type": "group-with-exclusion", "include": "g1", "except": "g2"}
+]`
+
+func TestPermissionGroupsExclusion(t *testing.T) {
+	objects := buildObjects(t, exclusionExport)
+
+	tests := []struct {
+		target  string
+		belongs []string
+		not     []string
+	}{
+		{target: "h1", belongs: []string{"web1", "net-web", "webs", "webs-but-2"}, not: []string{"only2"}},
+		{target: "h2", belongs: []string{"web2", "net-web", "webs", "only2"}, not: []string{"webs-but-2"}},
+		//Hosts found through the network don't bring their groups along
+		{target: "n1", belongs: []string{"net-web", "web1", "web2"}, not: []string{"webs", "only2", "webs-but-2"}},
+	}
+
+	for _, test := range tests {
+		for _, strict := range []bool{false, true} {
+			assoc, _ := permissionGroupsOf(objects[test.target], -1, strict)
+			found := names(assoc)
+
+			for _, name := range test.belongs {
+				if !found[name] {
+					t.Errorf("%s (strict %v) should belong to %s, got %v", test.target, strict, name, found)
+				}
+			}
+
+			for _, name := range test.not {
+				if found[name] {
+					t.Errorf("%s (strict %v) should not belong to %s", test.target, strict, name)
+				}
+			}
+		}
+	}
+}
+
+func TestPermissionGroupsHostTarget(t *testing.T) {
+	objects := buildObjects(t, `[
+		{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+		{"uid": "h2", "name": "web2", "type": "host", "ipv4-address": "10.0.0.2"},
+		{"uid": "n1", "name": "net-web", "type": "network", "subnet4": "10.0.0.0", "mask-length4": 24},
+		{"uid": "g1", "name": "webs", "type": "group", "members": ["h1"]},
+		{"uid": "g2", "name": "all-webs", "type": "group", "members": ["g1"]}
+	]`)
+
+	tests := []struct {
+		target  string
+		belongs []string
+		not     []string
+	}{
+		{target: "h1", belongs: []string{"web1", "net-web", "webs", "all-webs"}},
+		{target: "h2", belongs: []string{"web2", "net-web"}, not: []string{"webs", "all-webs"}},
+		//web1 is found through the network, its groups aren't the network's
+		{target: "n1", belongs: []string{"net-web", "web1", "web2"}, not: []string{"webs", "all-webs"}},
+	}
+
+	for _, test := range tests {
+		assoc, _ := PermissionGroups(objects[test.target], -1)
+		found := names(assoc)
+
+		for _, name := range test.belongs {
+			if !found[name] {
+				t.Errorf("%s should belong to %s, got %v", test.target, name, found)
+			}
+		}
+
+		for _, name := range test.not {
+			if found[name] {
+				t.Errorf("%s should not belong to %s", test.target, name)
+			}
+		}
+	}
+}
+
+func TestBuildGraphUnresolvedExclusion(t *testing.T) {
+	objects := buildObjects(t, `[
+		{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+		{"uid": "g1", "name": "webs", "type": "group", "members": ["h1"]},
+		{"uid": "x1", "name": "webs-but-missing", "type": "group-with-exclusion", "include": "g1", "except": "gone"}
+	]`)
+
+	assoc, _ := PermissionGroups(objects["h1"], -1)
+	found := names(assoc)
+	if !found["webs"] || found["webs-but-missing"] {
+		t.Errorf("web1 should only belong to webs, got %v", found)
+	}
+}
+
+func TestBuildGraphMembersByName(t *testing.T) {
+	objects := buildObjects(t, `[
+		{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+		{"uid": "h2", "name": "web2", "type": "host", "ipv4-address": "10.0.0.2"},
+		{"uid": "g1", "name": "webs", "type": "group", "members": ["web1", "h2", "ghost"]}
+	]`)
+
+	children, _ := AllChildren(objects["g1"], -1)
+	found := names(children)
+	if !found["web1"] || !found["web2"] {
+		t.Errorf("webs should have web1 and web2 as members, got %v", found)
+	}
+
+	//Unresolved members stay so they show up as missing
+	want := []string{"h1", "h2", "ghost"}
+	if got := objects["g1"].Members; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected members %v, got %v", want, got)
+	}
+
+	if n := Lookup(objects, "ghost"); n.Type != MissingType {
+		t.Errorf("ghost should be missing, got %s", n.Type)
+	}
+}
@@ -0,0 +1,110 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const graphFileVersion = 1
+
+type graphFile struct {
+	Version  int           `json:"version"`
+	Objects  []graphObject `json:"objects"`
+	Edges    []graphEdge   `json:"edges"`
+	Gateways []Gateway     `json:"gateways"`
+}
+
+type graphObject struct {
+	Node *Node `json:"node"`
+	//Indexes into the edges, in the order they were added to the object
+	Edges []int `json:"edges"`
+}
+
+type graphEdge struct {
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Method string `json:"method"`
+}
+
+// Writes objects after BuildGraph (and AddZones or AddNetworkHierarchy) with their edges, so LoadGraph can skip building it again.
+// Objects are in load order and edges in the order they were added, the same objects always give the same file
+func SaveGraph(w io.Writer, objects map[string]*Node, gateways []Gateway) error {
+	g := graphFile{Version: graphFileVersion, Objects: []graphObject{}, Edges: []graphEdge{}, Gateways: gateways}
+	if g.Gateways == nil {
+		g.Gateways = []Gateway{}
+	}
+
+	//Member edges are shared by both ends, they are written once
+	ids := make(map[*Edge]int)
+	for _, key := range loadOrder(objects) {
+		n := objects[key]
+
+		o := graphObject{Node: n, Edges: []int{}}
+		for _, e := range n.Edges {
+			id, ok := ids[e]
+			if !ok {
+				id = len(g.Edges)
+				ids[e] = id
+				g.Edges = append(g.Edges, graphEdge{Start: e.Start.Key(), End: e.End.Key(), Method: e.Method})
+			}
+			o.Edges = append(o.Edges, id)
+		}
+
+		g.Objects = append(g.Objects, o)
+	}
+
+	b, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// Reads a file written by SaveGraph, the objects are ready to audit without BuildGraph
+func LoadGraph(r io.Reader) (objects map[string]*Node, gateways []Gateway, err error) {
+	var g graphFile
+	if err := json.NewDecoder(r).Decode(&g); err != nil {
+		return nil, nil, err
+	}
+
+	if g.Version != graphFileVersion {
+		return nil, nil, fmt.Errorf("Graph file version %d is not supported, expected %d", g.Version, graphFileVersion)
+	}
+
+	objects = make(map[string]*Node, len(g.Objects))
+	for i, o := range g.Objects {
+		if o.Node == nil {
+			return nil, nil, fmt.Errorf("Object %d has no node", i)
+		}
+
+		o.Node.parsePorts()
+		o.Node.parseModified()
+		o.Node.order = i
+		objects[o.Node.Key()] = o.Node
+	}
+
+	edges := make([]*Edge, len(g.Edges))
+	for i, e := range g.Edges {
+		start, end := objects[e.Start], objects[e.End]
+		if start == nil || end == nil {
+			return nil, nil, fmt.Errorf("Edge %d from %s to %s does not resolve", i, e.Start, e.End)
+		}
+
+		edges[i] = &Edge{Start: start, End: end, Method: e.Method}
+	}
+
+	for i, o := range g.Objects {
+		for _, id := range o.Edges {
+			if id < 0 || id >= len(edges) {
+				return nil, nil, fmt.Errorf("Object %d has unknown edge %d", i, id)
+			}
+
+			o.Node.Edges = append(o.Node.Edges, edges[id])
+		}
+	}
+
+	return objects, g.Gateways, nil
+}
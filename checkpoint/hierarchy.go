@@ -0,0 +1,50 @@
+package checkpoint
+
+import "net"
+
+// Makes each network a member of the smallest networks strictly containing it, so associating walks up the whole supernet chain.
+// Networks with the same subnet are all linked. Call it after BuildGraph
+func AddNetworkHierarchy(objects map[string]*Node) {
+	type prefix struct{ ones, bits int }
+	buckets := make(map[prefix]map[string][]*Node)
+
+	var networks []*Node
+	for _, key := range loadOrder(objects) {
+		n := objects[key]
+		if n.Type != "network" {
+			continue
+		}
+		networks = append(networks, n)
+
+		for _, r := range n.Ranges() {
+			ones, bits := r.Mask.Size()
+			p := prefix{ones, bits}
+			if buckets[p] == nil {
+				buckets[p] = make(map[string][]*Node)
+			}
+			buckets[p][r.IP.String()] = append(buckets[p][r.IP.String()], n)
+		}
+	}
+
+	for _, n := range networks {
+		linked := make(map[*Node]bool)
+		for _, r := range n.Ranges() {
+			ones, bits := r.Mask.Size()
+
+			//Shortening the prefix one bit at a time, the first networks found are the closest supernets
+			for shorter := ones - 1; shorter >= 0; shorter-- {
+				supernets := buckets[prefix{shorter, bits}][r.IP.Mask(net.CIDRMask(shorter, bits)).String()]
+				for _, super := range supernets {
+					if super != n && !linked[super] {
+						linked[super] = true
+						Monodirectional(n, super)
+					}
+				}
+
+				if len(supernets) != 0 {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type NATRule struct {
+	Firewall string `json:"-"`
+	Uid      string
+	Name     string
+	Type     string
+	Number   int `json:"rule-number"`
+	Enabled  bool
+	Method   string
+	Comments string
+	Domain   DomainName
+
+	OriginalSource        Reference `json:"original-source"`
+	OriginalDestination   Reference `json:"original-destination"`
+	OriginalService       Reference `json:"original-service"`
+	TranslatedSource      Reference `json:"translated-source"`
+	TranslatedDestination Reference `json:"translated-destination"`
+	TranslatedService     Reference `json:"translated-service"`
+}
+
+// NAT rules of every set with their references resolved to object keys, anything else in the sets is skipped
+func ParseNATRules(ruleSets []RuleSet, objects map[string]*Node, domainFilter string) (rules []NATRule, err error) {
+	index := IndexByUid(objects)
+	for _, set := range ruleSets {
+		for i, r := range set.Rules {
+			var nat NATRule
+			if err := json.Unmarshal(r, &nat); err != nil {
+				return nil, fmt.Errorf("NAT rule %d of %s: %w", i, set.Firewall, err)
+			}
+
+			if nat.Type != "nat-rule" || !InDomain(nat.Domain, domainFilter) {
+				continue
+			}
+
+			for _, ref := range []*Reference{&nat.OriginalSource, &nat.OriginalDestination, &nat.OriginalService, &nat.TranslatedSource, &nat.TranslatedDestination, &nat.TranslatedService} {
+				if *ref != "" {
+					*ref = Reference(ResolveRef(objects, index, nat.Domain, string(*ref)))
+				}
+			}
+
+			nat.Firewall = set.Firewall
+			rules = append(rules, nat)
+		}
+	}
+
+	return
+}
+
+// NAT rules with an associated node as an original or translated address. Any is left out, hide NAT would match everything
+func TranslatingNAT(associated []*Node, rules []NATRule) (matching []NATRule) {
+	checkMap := make(map[string]bool)
+	for _, n := range associated {
+		checkMap[n.Key()] = true
+	}
+
+	for _, nat := range rules {
+		for _, ref := range []Reference{nat.OriginalSource, nat.OriginalDestination, nat.TranslatedSource, nat.TranslatedDestination} {
+			if checkMap[string(ref)] {
+				matching = append(matching, nat)
+				break
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,339 @@
+package checkpoint
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type given to placeholders for objects referenced but not in the export
+const MissingType = "missing"
+
+// Objects whose addresses are only known to the gateways, so what they contain can't be resolved from the export
+const (
+	UpdatableObjectType = "updatable-object"
+	DynamicObjectType   = "dynamic-object"
+)
+
+type Node struct {
+	Uid      string
+	Name     string
+	Comments string
+	Type     string
+	Domain   DomainName
+
+	IPv4          string `json:"ipv4-address"`
+	SubnetAddress string `json:"subnet4"`
+	MaskLength    int    `json:"mask-length4"`
+	//Older exports only have the dotted mask
+	SubnetMask  string `json:"subnet-mask"`
+	IPv6        string `json:"ipv6-address"`
+	Subnet6     string `json:"subnet6"`
+	MaskLength6 int    `json:"mask-length6"`
+	RangeFirst  string `json:"ipv4-address-first"`
+	RangeLast   string `json:"ipv4-address-last"`
+	Port        string
+	PortLow     int `json:"-"`
+	PortHigh    int `json:"-"`
+	Protocol    string
+	IcmpType    *int `json:"icmp-type"`
+	IcmpCode    *int `json:"icmp-code"`
+	Members     []string
+	//Uids or tag objects in the export, names once BuildGraph has run
+	Tags []TagName
+	//DNS domain objects match by name, the object name is the domain
+	IsSubDomain bool `json:"is-sub-domain"`
+	//Application sites can match URLs on top of the application itself
+	URLList []string `json:"url-list"`
+
+	//Groups with exclusion, everything in Include that isn't in Except
+	Include Reference
+	Except  Reference
+
+	//Time objects
+	Start       TimeBound
+	End         TimeBound
+	StartNow    bool         `json:"start-now"`
+	EndNever    bool         `json:"end-never"`
+	HoursRanges []HoursRange `json:"hours-ranges"`
+
+	MetaInfo struct {
+		LastModify struct {
+			Posix   int64
+			Iso8601 string `json:"iso-8601"`
+		} `json:"last-modify-time"`
+	} `json:"meta-info"`
+	//Zero when the export has no meta-info
+	Modified time.Time `json:"-"`
+
+	//Saved separately by SaveGraph, exports don't have them
+	Edges []*Edge `json:"-"`
+
+	//Position in the export, so the graph is built in load order
+	order int
+}
+
+type TimeBound struct {
+	Iso8601 string `json:"iso-8601"`
+}
+
+type HoursRange struct {
+	Enabled bool
+	From    string
+	To      string
+}
+
+type TagName string
+
+func (t *TagName) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*t = TagName(name)
+		return nil
+	}
+
+	var tag struct {
+		Name string
+	}
+	if err := json.Unmarshal(b, &tag); err != nil {
+		return err
+	}
+
+	*t = TagName(tag.Name)
+	return nil
+}
+
+// Tags compare case insensitively, prod and Prod are the same environment
+func (n *Node) HasTag(tag string) bool {
+	for _, t := range n.Tags {
+		if strings.EqualFold(string(t), tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Edge struct {
+	Start  *Node
+	End    *Node
+	Method string
+}
+
+func (n *Node) Hash() string {
+	return fmt.Sprintf("%s", md5.Sum([]byte(n.Uid+n.Name+n.Type+n.IPv4+n.SubnetAddress+n.IPv6+n.Subnet6+n.RangeFirst+n.RangeLast+n.Port+n.Protocol+string(n.Include)+string(n.Except))))
+}
+
+// Posix timestamps are in milliseconds, the iso-8601 form is only minute precision so it is the fallback
+func (n *Node) parseModified() {
+	if posix := n.MetaInfo.LastModify.Posix; posix != 0 {
+		n.Modified = time.Unix(posix/1000, (posix%1000)*int64(time.Millisecond)).UTC()
+		return
+	}
+
+	if modified, err := time.Parse("2006-01-02T15:04-0700", n.MetaInfo.LastModify.Iso8601); err == nil {
+		n.Modified = modified.UTC()
+	}
+}
+
+// Checkpoint ports are a single port, a "low-high" range or a ">port"/"<port" bound
+func (n *Node) parsePorts() {
+	port := strings.TrimSpace(n.Port)
+	if port == "" {
+		return
+	}
+
+	var low, high int
+	var err error
+	switch {
+	case strings.HasPrefix(port, ">"):
+		low, err = strconv.Atoi(port[1:])
+		low, high = low+1, 65535
+	case strings.HasPrefix(port, "<"):
+		high, err = strconv.Atoi(port[1:])
+		low, high = 0, high-1
+	case strings.Contains(port, "-"):
+		parts := strings.SplitN(port, "-", 2)
+		low, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err == nil {
+			high, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		}
+	default:
+		low, err = strconv.Atoi(port)
+		high = low
+	}
+
+	if err != nil {
+		return
+	}
+
+	n.PortLow, n.PortHigh = low, high
+}
+
+func (n *Node) PortString() string {
+	if n.PortLow == 0 && n.PortHigh == 0 {
+		return n.Port
+	}
+
+	if n.PortLow == n.PortHigh {
+		return strconv.Itoa(n.PortLow)
+	}
+
+	return fmt.Sprintf("%d-%d", n.PortLow, n.PortHigh)
+}
+
+func (n *Node) Addresses() (ips []net.IP) {
+	for _, address := range []string{n.IPv4, n.IPv6} {
+		if ip := net.ParseIP(address); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+
+	return
+}
+
+// Prefix length of the v4 subnet, from subnet-mask when mask-length4 is missing
+func (n *Node) maskLength4() (int, error) {
+	if n.MaskLength != 0 || n.SubnetMask == "" {
+		return n.MaskLength, nil
+	}
+
+	mask := net.ParseIP(n.SubnetMask).To4()
+	if mask == nil {
+		return 0, fmt.Errorf("Invalid subnet mask %s", n.SubnetMask)
+	}
+
+	ones, bits := net.IPMask(mask).Size()
+	if bits == 0 {
+		return 0, fmt.Errorf("Subnet mask %s is not contiguous", n.SubnetMask)
+	}
+
+	return ones, nil
+}
+
+func (n *Node) ParseRanges() (ranges []*net.IPNet, err error) {
+	if n.SubnetAddress != "" {
+		maskLength, err := n.maskLength4()
+		if err != nil {
+			return nil, err
+		}
+
+		_, netRange, err := net.ParseCIDR(fmt.Sprintf("%s/%d", n.SubnetAddress, maskLength))
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, netRange)
+	}
+
+	if n.Subnet6 != "" {
+		_, netRange, err := net.ParseCIDR(fmt.Sprintf("%s/%d", n.Subnet6, n.MaskLength6))
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, netRange)
+	}
+
+	return
+}
+
+// Networks that don't parse are rejected by BuildGraph, so this only drops them for graphs built by hand
+func (n *Node) Ranges() []*net.IPNet {
+	ranges, _ := n.ParseRanges()
+
+	return ranges
+}
+
+func (n *Node) Contains(host *Node) bool {
+	if n.Type == "address-range" {
+		first, last := net.ParseIP(n.RangeFirst), net.ParseIP(n.RangeLast)
+		if first == nil || last == nil {
+			return false
+		}
+
+		for _, ip := range host.Addresses() {
+			//Inclusive on both ends, To16 so v4 addresses compare at the same length
+			if bytes.Compare(ip.To16(), first.To16()) >= 0 && bytes.Compare(ip.To16(), last.To16()) <= 0 {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, netRange := range n.Ranges() {
+		for _, ip := range host.Addresses() {
+			if netRange.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func Bidirectional(n1 *Node, n2 *Node) {
+	to := Edge{Start: n1, End: n2, Method: "Di"}
+	from := Edge{Start: n2, End: n1, Method: "Di"}
+
+	n1.Edges = append(n1.Edges, &to)
+	n2.Edges = append(n2.Edges, &from)
+}
+
+func Monodirectional(to *Node, from *Node) {
+	e := Edge{Start: from, End: to, Method: "Mono"}
+
+	to.Edges = append(to.Edges, &e)
+	from.Edges = append(from.Edges, &e)
+}
+
+// Partial exports can reference objects we never loaded, show them as gaps instead of crashing
+func Lookup(objects map[string]*Node, uid string) *Node {
+	if n, ok := objects[uid]; ok {
+		return n
+	}
+
+	return &Node{Uid: uid, Name: "<missing:" + uid + ">", Type: MissingType}
+}
+
+// Callbacks given to loading and matching, so each caller hears about its own work. A nil Hooks or nil field keeps them quiet
+type Hooks struct {
+	//Long running steps, e.g to show progress on large exports
+	Progress func(stage string, done, total int)
+	//Rules passed over and why, e.g to debug a rule missing from a report
+	Skipped func(acl ACLRule, reason string)
+	//Problems with the export that loading works around, e.g duplicate uids or members that don't resolve
+	Warn func(msg string)
+}
+
+func (h *Hooks) progress(stage string, done, total int) {
+	if h != nil && h.Progress != nil {
+		h.Progress(stage, done, total)
+	}
+}
+
+func (h *Hooks) skipped(acl ACLRule, reason string) {
+	if h != nil && h.Skipped != nil {
+		h.Skipped(acl, reason)
+	}
+}
+
+func (h *Hooks) warn(format string, v ...interface{}) {
+	if h != nil && h.Warn != nil {
+		h.Warn(fmt.Sprintf(format, v...))
+	}
+}
+
+// Object types that match every address, not just the predefined Any object
+var anyTypes = map[string]bool{
+	"cpmianyobject": true,
+	"internet":      true,
+}
+
+func IsAnyObject(n *Node) bool {
+	return anyTypes[strings.ToLower(n.Type)]
+}
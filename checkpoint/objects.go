@@ -0,0 +1,395 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+)
+
+type Interface struct {
+	Address    string `json:"ipv4-address"`
+	MaskLength int    `json:"ipv4-mask-length"`
+	Name       string `json:"interface-name"`
+	Dynamic    bool   `json:"dynamic-ip"`
+}
+
+type Gateway struct {
+	Address    string `json:"ipv4-address"`
+	Name       string
+	Uid        string
+	Interfaces []Interface
+}
+
+// Range of the interface the address sits behind, empty when none of them
+func (g *Gateway) Belongs(ip net.IP) (string, error) {
+
+	for _, i := range g.Interfaces {
+		rangeString := fmt.Sprintf("%s/%d", i.Address, i.MaskLength)
+		_, network, err := net.ParseCIDR(rangeString)
+		if err != nil {
+			return "", err
+		}
+
+		if network.Contains(ip) {
+			return rangeString, nil
+		}
+
+	}
+
+	return "", nil
+}
+
+// Builds the objects up one at a time, so exports never have to be held in memory whole
+type ObjectLoader struct {
+	domainFilter string
+	hooks        *Hooks
+	objects      map[string]*Node
+	gateways     []Gateway
+	loaded       int
+}
+
+// Objects outside of domainFilter are skipped unless it is empty. hooks can be nil
+func NewObjectLoader(domainFilter string, hooks *Hooks) *ObjectLoader {
+	return &ObjectLoader{domainFilter: domainFilter, hooks: hooks, objects: make(map[string]*Node)}
+}
+
+// Adds a single object, the last of differing duplicates wins
+func (l *ObjectLoader) Add(v json.RawMessage) error {
+	var n Node
+	if err := json.Unmarshal(v, &n); err != nil {
+		return err
+	}
+	n.parsePorts()
+	n.parseModified()
+
+	if !InDomain(n.Domain, l.domainFilter) {
+		return nil
+	}
+
+	n.order = len(l.objects)
+	if existing, ok := l.objects[n.Key()]; ok {
+		if n.Type != "CpmiVsClusterNetobj" && n.Hash() == existing.Hash() {
+			return nil
+		}
+
+		if n.Type != "CpmiVsClusterNetobj" {
+			l.hooks.warn("Duplicate uid %s (%s), keeping the last one seen", n.Uid, n.Name)
+		}
+
+		//Replacing a duplicate keeps its original position
+		n.order = existing.order
+	}
+
+	l.objects[n.Key()] = &n
+
+	if n.Type == "CpmiVsClusterNetobj" {
+		var g Gateway
+		if err := json.Unmarshal(v, &g); err != nil {
+			return err
+		}
+		l.gateways = append(l.gateways, g)
+	}
+
+	return nil
+}
+
+// Streams a JSON array of objects, decoding one element at a time. Management API responses, with the array under "objects", are read the same way
+func (l *ObjectLoader) Read(r io.Reader) error {
+	err := ReadObjectArray(r, func(v json.RawMessage) error {
+		if err := l.Add(v); err != nil {
+			return err
+		}
+
+		l.loaded++
+		l.hooks.progress("objects loaded", l.loaded, 0)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	l.hooks.progress("objects loaded", l.loaded, l.loaded)
+	return nil
+}
+
+// Calls each with every element of an objects export as it is decoded. Exports are a bare array, or a management API response with the array under "objects"
+func ReadObjectArray(r io.Reader, each func(v json.RawMessage) error) error {
+	dec := json.NewDecoder(r)
+
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch t {
+	case json.Delim('['):
+		return readArray(dec, each)
+	case json.Delim('{'):
+	default:
+		return fmt.Errorf("Expected an array of objects, got %v", t)
+	}
+
+	found := false
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		if key != "objects" {
+			//Paging fields like from, to and total
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if t, err := dec.Token(); err != nil {
+			return err
+		} else if t != json.Delim('[') {
+			return fmt.Errorf("Expected an array of objects under \"objects\", got %v", t)
+		}
+
+		if err := readArray(dec, each); err != nil {
+			return err
+		}
+		found = true
+	}
+
+	if !found {
+		return errors.New("Expected an array of objects, got an object without \"objects\"")
+	}
+
+	_, err = dec.Token()
+	return err
+}
+
+// Elements up to and including the closing bracket, the opening one has been read
+func readArray(dec *json.Decoder, each func(v json.RawMessage) error) error {
+	for i := 0; dec.More(); i++ {
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return fmt.Errorf("Object %d: %w", i, err)
+		}
+
+		if err := each(v); err != nil {
+			return fmt.Errorf("Object %d: %w", i, err)
+		}
+	}
+
+	_, err := dec.Token()
+	return err
+}
+
+func (l *ObjectLoader) Objects() (objects map[string]*Node, gateways []Gateway) {
+	return l.objects, l.gateways
+}
+
+// Objects of a single export, BuildGraph has to be called on them before auditing
+func LoadObjects(r io.Reader) (map[string]*Node, error) {
+	l := NewObjectLoader("", nil)
+	if err := l.Read(r); err != nil {
+		return nil, err
+	}
+
+	objects, _ := l.Objects()
+	return objects, nil
+}
+
+// Objects of every export keyed by Node.Key, the last of differing duplicates wins. Filtered to domainFilter unless it is empty
+func ParseObjects(objectSets [][]json.RawMessage, domainFilter string, hooks *Hooks) (objects map[string]*Node, gateways []Gateway, err error) {
+	total, done := 0, 0
+	for _, jsonObjects := range objectSets {
+		total += len(jsonObjects)
+	}
+
+	l := NewObjectLoader(domainFilter, hooks)
+	for s, jsonObjects := range objectSets {
+		for i, v := range jsonObjects {
+			done++
+			hooks.progress("objects loaded", done, total)
+
+			if err := l.Add(v); err != nil {
+				return nil, nil, fmt.Errorf("Object %d of export %d: %w", i, s, err)
+			}
+		}
+	}
+
+	objects, gateways = l.Objects()
+	return
+}
+
+// Keys in load order, objects built by hand (all at position 0) fall back to key order
+func loadOrder(objects map[string]*Node) []string {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if objects[keys[i]].order != objects[keys[j]].order {
+			return objects[keys[i]].order < objects[keys[j]].order
+		}
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
+
+// Object keys by name. Names aren't unique, auto generated objects in particular share them
+func NameIndex(objects map[string]*Node) map[string][]string {
+	names := make(map[string][]string)
+	for _, key := range loadOrder(objects) {
+		names[objects[key].Name] = append(names[objects[key].Name], key)
+	}
+
+	return names
+}
+
+// Links groups to their members and hosts to the networks and address ranges containing them. Call it once per set of objects
+func BuildGraph(objects map[string]*Node, hooks *Hooks) error {
+
+	groups := []*Node{}
+	networks := []*Node{}
+	addressRanges := []*Node{}
+	hosts := []*Node{}
+	exclusions := []*Node{}
+
+	for _, key := range loadOrder(objects) {
+		n := objects[key]
+
+		switch n.Type {
+		case "host":
+			hosts = append(hosts, n)
+		case "group", "service-group":
+			groups = append(groups, n)
+		case "network":
+			networks = append(networks, n)
+		case "address-range":
+			addressRanges = append(addressRanges, n)
+		case "group-with-exclusion":
+			exclusions = append(exclusions, n)
+		}
+	}
+
+	//Dereference objects and populate groups
+	index := IndexByUid(objects)
+	names := NameIndex(objects)
+
+	//Tags given by uid are swapped for the names of their tag objects
+	for _, key := range loadOrder(objects) {
+		n := objects[key]
+		for i, t := range n.Tags {
+			if tag, ok := objects[ResolveRef(objects, index, n.Domain, string(t))]; ok && tag.Type == "tag" {
+				n.Tags[i] = TagName(tag.Name)
+			}
+		}
+	}
+
+	for _, g := range groups {
+		var members []string
+		for _, m := range g.Members {
+			key, ok := ResolveMember(objects, index, names, g.Domain, m)
+			if !ok {
+				//Kept without an edge, so the gap still shows (e.g <missing:uid> in service groups)
+				hooks.warn("Member %s of %s does not resolve by uid or name, showing it as missing", m, g.Name)
+				members = append(members, m)
+				continue
+			}
+
+			members = append(members, key)
+			Monodirectional(objects[key], g)
+		}
+		g.Members = members
+	}
+
+	//Only the include group is a member, the except group is checked when associating
+exclusion:
+	for _, g := range exclusions {
+		g.Include = Reference(ResolveRef(objects, index, g.Domain, string(g.Include)))
+		g.Except = Reference(ResolveRef(objects, index, g.Domain, string(g.Except)))
+
+		for _, ref := range []Reference{g.Include, g.Except} {
+			if _, ok := objects[string(ref)]; !ok {
+				hooks.warn("Member %s of %s does not resolve, leaving the group empty", ref, g.Name)
+				continue exclusion
+			}
+		}
+
+		Monodirectional(objects[string(g.Include)], g)
+	}
+
+	//Bucket networks by prefix and masked address, so each host only needs one lookup per prefix length in use
+	type prefix struct{ ones, bits int }
+	buckets := make(map[prefix]map[string][]int)
+	var prefixes []prefix
+
+	for n := range networks {
+		ranges, err := networks[n].ParseRanges()
+		if err != nil {
+			return fmt.Errorf("Network %s (%s): %w", networks[n].Name, networks[n].Uid, err)
+		}
+
+		for _, netRange := range ranges {
+			ones, bits := netRange.Mask.Size()
+			p := prefix{ones, bits}
+			if _, ok := buckets[p]; !ok {
+				buckets[p] = make(map[string][]int)
+				prefixes = append(prefixes, p)
+			}
+
+			buckets[p][netRange.IP.String()] = append(buckets[p][netRange.IP.String()], n)
+		}
+	}
+
+	//Hosts contained by each network, kept in host order so edges are added in the same order as before
+	containedHosts := make([][]int, len(networks))
+	for h := range hosts {
+		hooks.progress("hosts matched to networks", h+1, len(hosts))
+
+		for _, ip := range hosts[h].Addresses() {
+			for _, p := range prefixes {
+				addr := ip.To4()
+				if p.bits == 8*net.IPv6len {
+					if addr != nil {
+						continue
+					}
+					addr = ip.To16()
+				}
+
+				if addr == nil {
+					continue
+				}
+
+				for _, n := range buckets[p][addr.Mask(net.CIDRMask(p.ones, p.bits)).String()] {
+					if last := len(containedHosts[n]) - 1; last >= 0 && containedHosts[n][last] == h {
+						continue
+					}
+					containedHosts[n] = append(containedHosts[n], h)
+				}
+			}
+		}
+	}
+
+	for n := range networks {
+		for _, h := range containedHosts[n] {
+			Bidirectional(hosts[h], networks[n])
+		}
+	}
+
+	for r := range addressRanges {
+		hooks.progress("address ranges processed", r+1, len(addressRanges))
+
+		for h := range hosts {
+			if addressRanges[r].Contains(hosts[h]) {
+				Bidirectional(hosts[h], addressRanges[r])
+			}
+		}
+	}
+
+	return nil
+}
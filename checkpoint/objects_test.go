@@ -0,0 +1,112 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Hosts spread over /24 networks, with a /16 above every 256 of them
+func containmentObjects(hosts, networks int) map[string]*Node {
+	objects := make(map[string]*Node)
+	for i := 0; i < networks; i++ {
+		n := &Node{Uid: fmt.Sprintf("n%d", i), Name: fmt.Sprintf("net%d", i), Type: "network", MaskLength: 24}
+		n.SubnetAddress = fmt.Sprintf("10.%d.%d.0", i/256, i%256)
+		if i%256 == 0 {
+			n.MaskLength = 16
+		}
+		objects[n.Key()] = n
+	}
+
+	for i := 0; i < hosts; i++ {
+		h := &Node{Uid: fmt.Sprintf("h%d", i), Name: fmt.Sprintf("host%d", i), Type: "host"}
+		h.IPv4 = fmt.Sprintf("10.%d.%d.%d", (i/250)%8, i%256, 1+i%250)
+		objects[h.Key()] = h
+	}
+
+	return objects
+}
+
+func TestBuildGraphContainment(t *testing.T) {
+	objects := buildObjects(t, `[
+		{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+		{"uid": "h2", "name": "web6", "type": "host", "ipv6-address": "2001:db8::1"},
+		{"uid": "n1", "name": "net-web", "type": "network", "subnet4": "10.0.0.0", "mask-length4": 24},
+		{"uid": "n2", "name": "net-10", "type": "network", "subnet4": "10.0.0.0", "mask-length4": 8},
+		{"uid": "n3", "name": "net-other", "type": "network", "subnet4": "10.1.0.0", "mask-length4": 16},
+		{"uid": "n4", "name": "net-v6", "type": "network", "subnet6": "2001:db8::", "mask-length6": 64}
+	]`)
+
+	tests := []struct {
+		target  string
+		belongs []string
+		not     []string
+	}{
+		{target: "h1", belongs: []string{"net-web", "net-10"}, not: []string{"net-other", "net-v6"}},
+		{target: "h2", belongs: []string{"net-v6"}, not: []string{"net-web", "net-10", "net-other"}},
+	}
+
+	for _, test := range tests {
+		assoc, _ := PermissionGroups(objects[test.target], -1)
+		found := names(assoc)
+
+		for _, name := range test.belongs {
+			if !found[name] {
+				t.Errorf("%s should be in %s, got %v", test.target, name, found)
+			}
+		}
+
+		for _, name := range test.not {
+			if found[name] {
+				t.Errorf("%s should not be in %s", test.target, name)
+			}
+		}
+	}
+}
+
+func TestReadObjectArray(t *testing.T) {
+	tests := []struct {
+		export string
+		uids   []string
+		fails  bool
+	}{
+		{export: `[{"uid": "h1"}, {"uid": "h2"}]`, uids: []string{"h1", "h2"}},
+		{export: `{"from": 1, "to": 2, "objects": [{"uid": "h1"}, {"uid": "h2"}], "total": 2}`, uids: []string{"h1", "h2"}},
+		{export: `{"total": 0}`, fails: true},
+		{export: `"h1"`, fails: true},
+	}
+
+	for _, test := range tests {
+		var uids []string
+		err := ReadObjectArray(strings.NewReader(test.export), func(v json.RawMessage) error {
+			var n Node
+			if err := json.Unmarshal(v, &n); err != nil {
+				return err
+			}
+			uids = append(uids, n.Uid)
+			return nil
+		})
+
+		if (err != nil) != test.fails {
+			t.Errorf("%s: expected failure %v, got %v", test.export, test.fails, err)
+			continue
+		}
+
+		if strings.Join(uids, ",") != strings.Join(test.uids, ",") {
+			t.Errorf("%s: expected %v, got %v", test.export, test.uids, uids)
+		}
+	}
+}
+
+func BenchmarkBuildGraph(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		objects := containmentObjects(5000, 2000)
+		b.StartTimer()
+
+		if err := BuildGraph(objects, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type ACLRule struct {
+	Firewall      string `json:"-"`
+	Action        string
+	Name          string
+	SrcNegate     bool `json:"source-negate"`
+	DstNegate     bool `json:"destination-negate"`
+	Comments      string
+	Source        []string
+	Destination   []string
+	Type          string
+	Enabled       bool
+	Number        int `json:"rule-number"`
+	Service       []string
+	ServiceNegate bool `json:"service-negate"`
+	Time          []string
+	Domain        DomainName
+	Layer         string
+	InstallOn     []string `json:"install-on"`
+	//Nil when the export was made without hit counts
+	Hits *RuleHits
+
+	//Object that caused the rule to match the target, empty when a negated side matched
+	MatchedBy string `json:"-"`
+	//The rule as it is in the export
+	Raw json.RawMessage `json:"-"`
+}
+
+// How often a rule matched traffic, as counted by the gateways
+type RuleHits struct {
+	Value    int
+	LastDate struct {
+		Iso8601 string `json:"iso-8601"`
+	} `json:"last-date"`
+}
+
+// Rulebase export of a single firewall
+type RuleSet struct {
+	Firewall string
+	Rules    []json.RawMessage
+}
+
+// Access rules of every set, disabled ones included, with their references resolved to object keys
+func ParseRules(ruleSets []RuleSet, objects map[string]*Node, domainFilter string, hooks *Hooks) (rules []ACLRule, err error) {
+	index := IndexByUid(objects)
+	for _, set := range ruleSets {
+		for i, r := range set.Rules {
+			//Only the type decides, names and comments can mention access-rule too
+			var header struct {
+				Type   string
+				Name   string
+				Number int `json:"rule-number"`
+				Domain DomainName
+			}
+			if err := json.Unmarshal(r, &header); err != nil {
+				return nil, fmt.Errorf("Rule %d of %s: %w", i, set.Firewall, err)
+			}
+
+			if header.Type != "access-rule" {
+				hooks.skipped(ACLRule{Firewall: set.Firewall, Name: header.Name, Number: header.Number, Type: header.Type, Domain: header.Domain}, "type "+header.Type+" is not access-rule")
+			}
+
+			if header.Type == "access-rule" {
+				var acl ACLRule
+				if err := json.Unmarshal(r, &acl); err != nil {
+					return nil, fmt.Errorf("Rule %d of %s: %w", i, set.Firewall, err)
+				}
+
+				if !InDomain(acl.Domain, domainFilter) {
+					acl.Firewall = set.Firewall
+					hooks.skipped(acl, "domain "+string(acl.Domain)+" is filtered out")
+					continue
+				}
+
+				acl.Source = ResolveRefs(objects, index, acl.Domain, acl.Source)
+				acl.Destination = ResolveRefs(objects, index, acl.Domain, acl.Destination)
+				acl.Service = ResolveRefs(objects, index, acl.Domain, acl.Service)
+				acl.Action = ResolveRef(objects, index, acl.Domain, acl.Action)
+				acl.Time = ResolveRefs(objects, index, acl.Domain, acl.Time)
+				acl.InstallOn = ResolveRefs(objects, index, acl.Domain, acl.InstallOn)
+				if acl.Layer != "" {
+					acl.Layer = ResolveRef(objects, index, acl.Domain, acl.Layer)
+				}
+				acl.Firewall = set.Firewall
+				acl.Raw = r
+				rules = append(rules, acl)
+			}
+		}
+	}
+
+	return
+}
+
+func doRuleApply(associatedObjects map[string]bool, objects map[string]*Node, acl ACLRule, uid string) bool {
+	return (associatedObjects[uid] || IsAnyObject(Lookup(objects, uid)))
+}
+
+// Negated sides are the complement of their objects, so they match when none of the objects apply.
+// viaAny is set when only an Any object matched, an object the target is under wins over Any
+func sideMatches(checkMap map[string]bool, objects map[string]*Node, acl ACLRule, uids []string, negate bool) (matches bool, matchedBy string, viaAny bool) {
+	applies := false
+	for _, uid := range uids {
+		if checkMap[uid] {
+			applies, matchedBy, viaAny = true, uid, false
+			break
+		}
+
+		if !applies && doRuleApply(checkMap, objects, acl, uid) {
+			applies, matchedBy, viaAny = true, uid, true
+		}
+	}
+
+	if negate {
+		return !applies, "", false
+	}
+
+	return applies, matchedBy, viaAny
+}
+
+func sideReason(side string, negated bool) string {
+	if negated {
+		return "in negated " + side
+	}
+
+	return "not in " + side
+}
+
+// Splits the rules by which side the associated nodes match. Rules with the target on both sides are in both lists, and in intra as well.
+// A side matched only through Any doesn't count when the other side names the target
+func Classify(associated []*Node, objects map[string]*Node, rules []ACLRule, hooks *Hooks) (accessTo []ACLRule, accessFrom []ACLRule, intra []ACLRule) {
+	checkMap := make(map[string]bool)
+	for _, n := range associated {
+		checkMap[n.Key()] = true
+	}
+
+	for i, acl := range rules {
+		hooks.progress("rules scanned", i+1, len(rules))
+
+		srcMatches, srcBy, srcAny := sideMatches(checkMap, objects, acl, acl.Source, acl.SrcNegate)
+		dstMatches, dstBy, dstAny := sideMatches(checkMap, objects, acl, acl.Destination, acl.DstNegate)
+
+		//Any on one side says nothing about the target when the other side names it
+		if srcMatches && !(srcAny && dstMatches && !dstAny) {
+			acl.MatchedBy = srcBy
+			accessTo = append(accessTo, acl)
+		}
+
+		if dstMatches && !(dstAny && srcMatches && !srcAny) {
+			acl.MatchedBy = dstBy
+			accessFrom = append(accessFrom, acl)
+		}
+
+		if srcMatches && !srcAny && dstMatches && !dstAny {
+			acl.MatchedBy = srcBy
+			intra = append(intra, acl)
+		}
+
+		if !srcMatches && !dstMatches {
+			hooks.skipped(acl, "target "+sideReason("source", acl.SrcNegate)+" and "+sideReason("destination", acl.DstNegate))
+		}
+	}
+
+	return
+}
+
+// Objects that stand for n when it is one end of a connection, everything under it and whatever those belong to
+func expandSet(n *Node, objects map[string]*Node) []*Node {
+	members := make(map[string]bool)
+	ExpandMembers(n, objects, members)
+
+	seen := make(map[*Node]bool)
+	var set []*Node
+	for _, key := range loadOrder(objects) {
+		if !members[key] {
+			continue
+		}
+
+		assoc, _ := PermissionGroups(objects[key], -1)
+		for _, a := range assoc {
+			if !seen[a] {
+				seen[a] = true
+				set = append(set, a)
+			}
+		}
+	}
+
+	return set
+}
+
+// Rules that let anything under src reach anything under dst, the caller picks which rules to consider (e.g enabled accepts)
+func Reachable(src, dst *Node, objects map[string]*Node, rules []ACLRule, hooks *Hooks) (connecting []ACLRule) {
+	keys := func(nodes []*Node) map[string]bool {
+		set := make(map[string]bool)
+		for _, n := range nodes {
+			set[n.Key()] = true
+		}
+		return set
+	}
+
+	//Unlike Classify, Any counts on both sides as it does reach src and dst
+	srcMap, dstMap := keys(expandSet(src, objects)), keys(expandSet(dst, objects))
+	for i, acl := range rules {
+		hooks.progress("rules scanned", i+1, len(rules))
+
+		srcMatches, _, _ := sideMatches(srcMap, objects, acl, acl.Source, acl.SrcNegate)
+		dstMatches, dstBy, _ := sideMatches(dstMap, objects, acl, acl.Destination, acl.DstNegate)
+
+		switch {
+		case !srcMatches:
+			hooks.skipped(acl, "src "+sideReason("source", acl.SrcNegate))
+		case !dstMatches:
+			hooks.skipped(acl, "dst "+sideReason("destination", acl.DstNegate))
+		default:
+			acl.MatchedBy = dstBy
+			connecting = append(connecting, acl)
+		}
+	}
+
+	return
+}
+
+// Rules with the target (or anything it belongs to) as the source and as the destination
+func Audit(target *Node, objects map[string]*Node, rules []ACLRule, hooks *Hooks) (to, from []ACLRule) {
+	associated, _ := PermissionGroups(target, -1)
+	to, from, _ = Classify(associated, objects, rules, hooks)
+
+	return
+}
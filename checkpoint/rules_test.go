@@ -0,0 +1,205 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func contains(rules []ACLRule, number int) bool {
+	for _, acl := range rules {
+		if acl.Number == number {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestClassifyNegatedSource(t *testing.T) {
+	objects := buildObjects(t, `[
+		{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+		{"uid": "h2", "name": "web2", "type": "host", "ipv4-address": "10.0.0.2"},
+		{"uid": "h3", "name": "db1", "type": "host", "ipv4-address": "10.0.1.1"},
+		{"uid": "n1", "name": "net-web", "type": "network", "subnet4": "10.0.0.0", "mask-length4": 24}
+	]`)
+
+	rules := []ACLRule{
+		{Number: 1, Source: []string{"n1"}, SrcNegate: true, Destination: []string{"h2"}},
+		{Number: 2, Source: []string{"n1"}, Destination: []string{"h2"}},
+	}
+
+	tests := []struct {
+		target string
+		to     map[int]bool
+	}{
+		//web1 is in net-web, so everything but net-web leaves it out
+		{target: "h1", to: map[int]bool{1: false, 2: true}},
+		//db1 is outside net-web, so the negated source has it
+		{target: "h3", to: map[int]bool{1: true, 2: false}},
+	}
+
+	for _, test := range tests {
+		to, _ := Audit(objects[test.target], objects, rules, nil)
+		for number, want := range test.to {
+			if got := contains(to, number); got != want {
+				t.Errorf("Rule %d with %s as the source: expected %v, got %v", number, test.target, want, got)
+			}
+		}
+	}
+}
+
+func TestClassifyNegatedDestination(t *testing.T) {
+	objects := buildObjects(t, `[
+		{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+		{"uid": "h3", "name": "db1", "type": "host", "ipv4-address": "10.0.1.1"},
+		{"uid": "n1", "name": "net-web", "type": "network", "subnet4": "10.0.0.0", "mask-length4": 24}
+	]`)
+
+	rules := []ACLRule{
+		{Number: 1, Source: []string{"h3"}, Destination: []string{"n1"}, DstNegate: true},
+		{Number: 2, Source: []string{"h3"}, Destination: []string{"n1"}},
+	}
+
+	tests := []struct {
+		target string
+		from   map[int]bool
+	}{
+		//web1 is in net-web, which the negated destination leaves out
+		{target: "h1", from: map[int]bool{1: false, 2: true}},
+		//db1 is outside net-web, so the negated destination permits it
+		{target: "h3", from: map[int]bool{1: true, 2: false}},
+	}
+
+	for _, test := range tests {
+		_, from := Audit(objects[test.target], objects, rules, nil)
+		for number, want := range test.from {
+			if got := contains(from, number); got != want {
+				t.Errorf("Rule %d permitting %s: expected %v, got %v", number, test.target, want, got)
+			}
+		}
+	}
+}
+
+func TestClassifyAnyObjects(t *testing.T) {
+	objects := buildObjects(t, `[
+		{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+		{"uid": "h2", "name": "db1", "type": "host", "ipv4-address": "10.0.1.1"},
+		{"uid": "any", "name": "Any", "type": "CpmiAnyObject"},
+		{"uid": "inet", "name": "Internet", "type": "Internet"}
+	]`)
+
+	tests := []struct {
+		source  string
+		matches bool
+	}{
+		{source: "inet", matches: true},
+		{source: "any", matches: true},
+		{source: "h2", matches: false},
+	}
+
+	for _, test := range tests {
+		rules := []ACLRule{{Number: 1, Source: []string{test.source}, Destination: []string{"h2"}}}
+
+		to, _ := Audit(objects["h1"], objects, rules, nil)
+		if got := contains(to, 1); got != test.matches {
+			t.Errorf("Rule from %s matching web1 as its source: expected %v, got %v", test.source, test.matches, got)
+		}
+	}
+
+	if !IsAnyObject(objects["inet"]) || IsAnyObject(objects["h1"]) {
+		t.Error("Only Any and Internet objects should match everything")
+	}
+}
+
+func TestClassifyIntraTarget(t *testing.T) {
+	objects := buildObjects(t, exclusionExport)
+
+	rules := []ACLRule{
+		{Number: 1, Source: []string{"g1"}, Destination: []string{"g1"}},
+		{Number: 2, Source: []string{"g1"}, Destination: []string{"h3"}},
+		{Number: 3, Source: []string{"h3"}, Destination: []string{"g1"}},
+	}
+
+	associated, _ := PermissionGroups(objects["g1"], -1)
+	to, from, intra := Classify(associated, objects, rules, nil)
+
+	tests := []struct {
+		name  string
+		rules []ACLRule
+		want  map[int]bool
+	}{
+		{name: "access to", rules: to, want: map[int]bool{1: true, 2: true, 3: false}},
+		{name: "access from", rules: from, want: map[int]bool{1: true, 2: false, 3: true}},
+		{name: "intra-target", rules: intra, want: map[int]bool{1: true, 2: false, 3: false}},
+	}
+
+	for _, test := range tests {
+		for number, want := range test.want {
+			if got := contains(test.rules, number); got != want {
+				t.Errorf("Rule %d in %s: expected %v, got %v", number, test.name, want, got)
+			}
+		}
+	}
+}
+
+func TestClassifyAnySide(t *testing.T) {
+	objects := buildObjects(t, `[
+		{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+		{"uid": "n1", "name": "net-web", "type": "network", "subnet4": "10.0.0.0", "mask-length4": 24},
+		{"uid": "any", "name": "Any", "type": "CpmiAnyObject"}
+	]`)
+
+	rules := []ACLRule{
+		{Number: 1, Source: []string{"h1"}, Destination: []string{"any"}},
+		{Number: 2, Source: []string{"any"}, Destination: []string{"n1"}},
+		//Nothing names the target, Any still takes it both ways
+		{Number: 3, Source: []string{"any"}, Destination: []string{"any"}},
+	}
+
+	associated, _ := PermissionGroups(objects["h1"], -1)
+	to, from, intra := Classify(associated, objects, rules, nil)
+
+	tests := []struct {
+		name  string
+		rules []ACLRule
+		want  map[int]bool
+	}{
+		{name: "access to", rules: to, want: map[int]bool{1: true, 2: false, 3: true}},
+		{name: "access from", rules: from, want: map[int]bool{1: false, 2: true, 3: true}},
+		{name: "intra-target", rules: intra, want: map[int]bool{1: false, 2: false, 3: false}},
+	}
+
+	for _, test := range tests {
+		for number, want := range test.want {
+			if got := contains(test.rules, number); got != want {
+				t.Errorf("Rule %d in %s: expected %v, got %v", number, test.name, want, got)
+			}
+		}
+	}
+}
+
+func TestParseRulesByType(t *testing.T) {
+	objects := buildObjects(t, `[
+		{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+		{"uid": "h3", "name": "db1", "type": "host", "ipv4-address": "10.0.1.1"}
+	]`)
+
+	set := RuleSet{Firewall: "fw1", Rules: []json.RawMessage{
+		json.RawMessage(`{"type": "access-section", "name": "legacy access-rule cleanup", "comments": "was an access-rule"}`),
+		json.RawMessage(`{"type": "place-holder", "rule-number": 2, "comments": "access-rule moved to the inline layer"}`),
+		json.RawMessage(`{"type": "access-rule", "rule-number": 3, "name": "not an access-rule cleanup", "source": ["h1"], "destination": ["h3"]}`),
+	}}
+
+	rules, err := ParseRules([]RuleSet{set}, objects, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules) != 1 || rules[0].Number != 3 {
+		t.Fatalf("Only rule 3 is an access rule, got %v", rules)
+	}
+
+	if rules[0].Firewall != "fw1" || rules[0].Source[0] != "h1" {
+		t.Errorf("Rule 3 wasn't parsed as expected: %+v", rules[0])
+	}
+}
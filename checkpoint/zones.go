@@ -0,0 +1,57 @@
+package checkpoint
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Security zones have no members in the objects export, gateways assign them per interface. The topology maps each zone
+// to the hosts and networks behind it, both given by name or uid. Call it after BuildGraph
+func AddZones(objects map[string]*Node, topology map[string][]string) error {
+	names := NameIndex(objects)
+	index := IndexByUid(objects)
+
+	find := func(ref string) (*Node, error) {
+		if n, ok := objects[ResolveRef(objects, index, "", ref)]; ok {
+			return n, nil
+		}
+
+		switch keys := names[ref]; len(keys) {
+		case 0:
+			return nil, fmt.Errorf("Object %s not found", ref)
+		case 1:
+			return objects[keys[0]], nil
+		default:
+			return nil, fmt.Errorf("Object %s is ambiguous, use its uid", ref)
+		}
+	}
+
+	//Sorted so edges are added in the same order every run
+	zones := make([]string, 0, len(topology))
+	for z := range topology {
+		zones = append(zones, z)
+	}
+	sort.Strings(zones)
+
+	for _, z := range zones {
+		zone, err := find(z)
+		if err != nil {
+			return err
+		}
+
+		if zone.Type != "security-zone" {
+			return fmt.Errorf("%s is a %s, not a security-zone", z, zone.Type)
+		}
+
+		for _, m := range topology[z] {
+			member, err := find(m)
+			if err != nil {
+				return fmt.Errorf("Member %s of zone %s: %s", m, z, err)
+			}
+
+			Monodirectional(member, zone)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"strings"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+type diffReport struct {
+	Target            string    `json:"target"`
+	AccessToAdded     []ruleRow `json:"access_to_added"`
+	AccessToRemoved   []ruleRow `json:"access_to_removed"`
+	AccessFromAdded   []ruleRow `json:"access_from_added"`
+	AccessFromRemoved []ruleRow `json:"access_from_removed"`
+
+	//Rules with the target on both sides are in both sets but only counted once
+	added, removed int
+}
+
+// What the rule does rather than where it is, so renumbered rules still match. The firewall comes from the file name, which can differ between snapshots
+func ruleHash(acl checkpoint.ACLRule) string {
+	parts := []string{
+		acl.Action,
+		strings.Join(acl.Source, ","), fmt.Sprint(acl.SrcNegate),
+		strings.Join(acl.Destination, ","), fmt.Sprint(acl.DstNegate),
+		strings.Join(acl.Service, ","), fmt.Sprint(acl.ServiceNegate),
+	}
+
+	return fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(parts, "|"))))
+}
+
+// Rules only in after are added, rules only in before are removed. Same numbered rules are paired first, then any rule with the same hash
+func diffRules(before, after []checkpoint.ACLRule) (added, removed []checkpoint.ACLRule) {
+	hashes := make([]string, len(before))
+	for i, acl := range before {
+		hashes[i] = ruleHash(acl)
+	}
+
+	paired := make([]bool, len(before))
+	pair := func(acl checkpoint.ACLRule, sameNumber bool) bool {
+		hash := ruleHash(acl)
+		for i := range before {
+			if !paired[i] && hashes[i] == hash && (!sameNumber || before[i].Number == acl.Number) {
+				paired[i] = true
+				return true
+			}
+		}
+		return false
+	}
+
+	var renumbered []checkpoint.ACLRule
+	for _, acl := range after {
+		if !pair(acl, true) {
+			renumbered = append(renumbered, acl)
+		}
+	}
+
+	for _, acl := range renumbered {
+		if !pair(acl, false) {
+			added = append(added, acl)
+		}
+	}
+
+	for i, acl := range before {
+		if !paired[i] {
+			removed = append(removed, acl)
+		}
+	}
+
+	return
+}
+
+func diffAudits(before, after *checkpoint.Node, beforeObjects, afterObjects map[string]*checkpoint.Node, beforeRules, afterRules []checkpoint.ACLRule) diffReport {
+	beforeTo, beforeFrom := checkpoint.Audit(before, beforeObjects, beforeRules, &hooks)
+	afterTo, afterFrom := checkpoint.Audit(after, afterObjects, afterRules, &hooks)
+
+	toAdded, toRemoved := diffRules(beforeTo, afterTo)
+	fromAdded, fromRemoved := diffRules(beforeFrom, afterFrom)
+
+	return diffReport{
+		added:             countUnique(toAdded, fromAdded),
+		removed:           countUnique(toRemoved, fromRemoved),
+		Target:            after.Name,
+		AccessToAdded:     buildRows(toAdded, afterObjects),
+		AccessToRemoved:   buildRows(toRemoved, beforeObjects),
+		AccessFromAdded:   buildRows(fromAdded, afterObjects),
+		AccessFromRemoved: buildRows(fromRemoved, beforeObjects),
+	}
+}
+
+func countUnique(lists ...[]checkpoint.ACLRule) int {
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, acl := range list {
+			seen[ruleKey(acl)] = true
+		}
+	}
+
+	return len(seen)
+}
+
+func printDiff(d diffReport, format string) {
+	if format == "json" {
+		b, err := marshalJSON(topJSON(d))
+		check(err)
+
+		fmt.Fprintln(out, string(b))
+		return
+	}
+
+	r := newReport(d.Target)
+	sections := []section{
+		r.ruleSection("access_to_added", d.Target+"->Target Added", d.AccessToAdded),
+		r.ruleSection("access_to_removed", d.Target+"->Target Removed", d.AccessToRemoved),
+		r.ruleSection("access_from_added", "Target->"+d.Target+" Added", d.AccessFromAdded),
+		r.ruleSection("access_from_removed", "Target->"+d.Target+" Removed", d.AccessFromRemoved),
+	}
+
+	switch format {
+	case "csv":
+		printCSV(out, sections)
+		return
+	case "tsv":
+		printTSV(out, sections)
+		return
+	case "markdown":
+		printMarkdown(out, sections)
+	default:
+		printTables(sections)
+	}
+
+	fmt.Fprintf(out, "\n%d rules added and %d removed\n", d.added, d.removed)
+}
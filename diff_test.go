@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+func TestDiffRules(t *testing.T) {
+	renumbered := testRule(5, "h1", "h3", "s1")
+	renamed := testRule(1, "h1", "h3", "")
+	renamed.Firewall = "fw1-2026-01"
+
+	changed := testRule(2, "h2", "h3", "")
+	changed.Action = "drop"
+
+	before := []checkpoint.ACLRule{testRule(1, "h1", "h3", ""), testRule(2, "h2", "h3", ""), testRule(3, "h1", "h3", "s1")}
+	after := []checkpoint.ACLRule{renamed, changed, renumbered}
+
+	added, removed := diffRules(before, after)
+	if len(added) != 1 || added[0].Number != 2 {
+		t.Errorf("Only rule 2 should be added, got %v", added)
+	}
+
+	if len(removed) != 1 || removed[0].Number != 2 {
+		t.Errorf("Only rule 2 should be removed, got %v", removed)
+	}
+}
+
+func TestDiffAuditsCountsRulesOnce(t *testing.T) {
+	objects := testObjects(t, testExport)
+
+	//web1 is on both sides, so the rule is in both sets
+	after := []checkpoint.ACLRule{testRule(1, "g1", "h1", "")}
+
+	d := diffAudits(objects["h1"], objects["h1"], objects, objects, nil, after)
+	if len(d.AccessToAdded) != 1 || len(d.AccessFromAdded) != 1 {
+		t.Fatalf("The rule should be added to both sets, got %d and %d", len(d.AccessToAdded), len(d.AccessFromAdded))
+	}
+
+	if d.added != 1 || d.removed != 0 {
+		t.Errorf("Expected 1 rule added and 0 removed, got %d and %d", d.added, d.removed)
+	}
+}
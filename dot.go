@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+func dotShape(n *checkpoint.Node) string {
+	switch n.Type {
+	case "host":
+		return "box"
+	case "network":
+		return "ellipse"
+	case "address-range":
+		return "hexagon"
+	case "group":
+		return "folder"
+	}
+
+	return "plaintext"
+}
+
+func writeDot(w io.Writer, nodes []*checkpoint.Node) {
+	included := make(map[*checkpoint.Node]bool)
+	for _, n := range nodes {
+		included[n] = true
+	}
+
+	fmt.Fprintln(w, "digraph audit {")
+
+	for _, n := range nodes {
+		fmt.Fprintf(w, "\t%q [label=%q, shape=%s];\n", n.Key(), n.Name+" ("+n.Type+")", dotShape(n))
+	}
+
+	//Monodirectional edges sit on both nodes and bidirectional ones come in pairs, so only draw each once
+	drawn := make(map[[2]*checkpoint.Node]bool)
+	for _, n := range nodes {
+		for _, e := range n.Edges {
+			if !included[e.Start] || !included[e.End] || drawn[[2]*checkpoint.Node{e.Start, e.End}] {
+				continue
+			}
+
+			drawn[[2]*checkpoint.Node{e.Start, e.End}] = true
+
+			switch e.Method {
+			case "Mono":
+				fmt.Fprintf(w, "\t%q -> %q;\n", e.Start.Key(), e.End.Key())
+			case "Di":
+				drawn[[2]*checkpoint.Node{e.End, e.Start}] = true
+				fmt.Fprintf(w, "\t%q -> %q [dir=none];\n", e.Start.Key(), e.End.Key())
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "}")
+}
+
+func saveDot(path string, nodes []*checkpoint.Node) {
+	f, err := os.Create(path)
+	check(err)
+	defer f.Close()
+
+	writeDot(f, nodes)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+type htmlCell struct {
+	Values []string
+	Anchor string
+}
+
+type htmlTable struct {
+	Title   string
+	Headers []string
+	Rows    [][]htmlCell
+}
+
+type htmlObject struct {
+	Anchor string
+	Name   string
+	Fields [][2]string
+}
+
+type htmlTarget struct {
+	Name   string
+	Tables []htmlTable
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Checkpoint audit</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+caption { text-align: left; font-weight: bold; padding: 0.5em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; vertical-align: top; text-align: left; }
+th { background: #f0f0f0; }
+tr:target, div:target { background: #fff3c4; }
+</style>
+</head>
+<body>
+{{range .Targets}}
+<h1>{{.Name}}</h1>
+{{range .Tables}}
+<table>
+<caption>{{.Title}}</caption>
+<tr>{{range .Headers}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{if .Anchor}}<a href="#{{.Anchor}}">{{end}}{{range $i, $v := .Values}}{{if $i}}<br>{{end}}{{$v}}{{end}}{{if .Anchor}}</a>{{end}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+{{end}}
+<h1>Objects</h1>
+{{range .Objects}}
+<div id="{{.Anchor}}">
+<table>
+<caption>{{.Name}}</caption>
+{{range .Fields}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+func objectAnchor(uid string) string {
+	return "object-" + uid
+}
+
+func htmlTables(sections []section) (tables []htmlTable) {
+	for _, s := range sections {
+		t := htmlTable{Title: s.Title, Headers: s.Headers}
+		for _, row := range s.Rows {
+			var cells []htmlCell
+			for i, c := range row {
+				hc := htmlCell{Values: c}
+				if s.Key == "belongs_to" && s.Headers[i] == "UID" {
+					hc.Anchor = objectAnchor(s.Keys[len(t.Rows)])
+				}
+				cells = append(cells, hc)
+			}
+			t.Rows = append(t.Rows, cells)
+		}
+		tables = append(tables, t)
+	}
+
+	return
+}
+
+func objectDetails(n *checkpoint.Node) htmlObject {
+	o := htmlObject{Anchor: objectAnchor(n.Key()), Name: n.Name}
+
+	add := func(name, value string) {
+		if value != "" {
+			o.Fields = append(o.Fields, [2]string{name, value})
+		}
+	}
+
+	add("UID", n.Uid)
+	add("Domain", string(n.Domain))
+	add("Type", n.Type)
+	add("IPv4", n.IPv4)
+	add("IPv6", n.IPv6)
+	for _, r := range n.Ranges() {
+		add("Network", r.String())
+	}
+	if n.RangeFirst != "" {
+		add("Range", n.RangeFirst+"-"+n.RangeLast)
+	}
+	add("Port", n.Port)
+	add("Protocol", n.Protocol)
+	if len(n.Members) != 0 {
+		add("Members", fmt.Sprintf("%d", len(n.Members)))
+	}
+	var tags []string
+	for _, t := range n.Tags {
+		tags = append(tags, string(t))
+	}
+	add("Tags", strings.Join(tags, ", "))
+	add("Comments", strings.TrimSpace(n.Comments))
+
+	return o
+}
+
+func saveHTML(path string, reports []*report, allObjects map[string]*checkpoint.Node) {
+	var data struct {
+		Targets []htmlTarget
+		Objects []htmlObject
+	}
+
+	seen := make(map[string]bool)
+	for _, r := range reports {
+		data.Targets = append(data.Targets, htmlTarget{Name: r.Target, Tables: htmlTables(r.sections())})
+
+		for _, m := range r.BelongsTo {
+			key := checkpoint.ObjectKey(checkpoint.DomainName(m.Domain), m.UID)
+			if !seen[key] {
+				seen[key] = true
+				data.Objects = append(data.Objects, objectDetails(checkpoint.Lookup(allObjects, key)))
+			}
+		}
+	}
+
+	sort.Slice(data.Objects, func(i, j int) bool {
+		return data.Objects[i].Name < data.Objects[j].Name
+	})
+
+	f, err := os.Create(path)
+	check(err)
+	defer f.Close()
+
+	check(htmlReport.Execute(f, data))
+}
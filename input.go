@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+const stdinPath = "-"
+
+// Exports are often shipped gzipped, those are recognised by their magic bytes rather than the name
+func decompress(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+
+	magic, err := buffered.Peek(2)
+	if err != nil || !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return buffered, nil
+	}
+
+	return gzip.NewReader(buffered)
+}
+
+func readInput(p string) ([]byte, error) {
+	r, closer, err := openInput(p)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	return ioutil.ReadAll(r)
+}
+
+func readArray(p string) (arr []json.RawMessage, err error) {
+	b, err := readInput(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &arr); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+
+	return
+}
+
+// Objects exports are a bare array, or a management API response with the array under "objects"
+func readObjects(p string) (objects []json.RawMessage, err error) {
+	r, closer, err := openInput(p)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	err = checkpoint.ReadObjectArray(r, func(v json.RawMessage) error {
+		objects = append(objects, v)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+
+	return objects, nil
+}
+
+// Single stream containing both exports, used when objects and rules are both read from stdin
+func readCombined(r io.Reader) (objects []json.RawMessage, rules []json.RawMessage, err error) {
+	var combined struct {
+		Objects []json.RawMessage
+		Rules   []json.RawMessage
+	}
+
+	r, err = decompress(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := json.NewDecoder(r).Decode(&combined); err != nil {
+		return nil, nil, fmt.Errorf("stdin: %w", err)
+	}
+
+	return combined.Objects, combined.Rules, nil
+}
+
+// Comma separated list of files or glob patterns, a pattern that matches nothing is kept so reading it reports the error
+func expandPaths(list string) (paths []string, err error) {
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+
+		if p == stdinPath || len(matches) == 0 {
+			paths = append(paths, p)
+			continue
+		}
+
+		paths = append(paths, matches...)
+	}
+
+	return
+}
+
+func globAll(directory string, patterns ...string) (paths []string, err error) {
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(path.Join(directory, pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, matches...)
+	}
+
+	return
+}
+
+func objectPaths(directory, objsPath string) ([]string, error) {
+	if objsPath == "" {
+		return globAll(directory, "*_objects.json", "*_objects.json.gz")
+	}
+
+	return expandPaths(objsPath)
+}
+
+// Zone names or uids to the names or uids of their members, e.g {"DMZ": ["net-dmz", "web1"]}
+func loadZones(p string) (zones map[string][]string, err error) {
+	b, err := readInput(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &zones); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+
+	return
+}
+
+// Raw objects of every export, for checks that have to see objects that won't parse
+func loadObjectSets(directory, objsPath string) (sets [][]json.RawMessage, err error) {
+	paths, err := objectPaths(directory, objsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range paths {
+		arr, err := readObjects(p)
+		if err != nil {
+			return nil, err
+		}
+
+		sets = append(sets, arr)
+	}
+
+	return
+}
+
+func openInput(p string) (io.Reader, func() error, error) {
+	if p == stdinPath {
+		r, err := decompress(os.Stdin)
+		return r, func() error { return nil }, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := decompress(f)
+	return r, f.Close, err
+}
+
+// Objects are decoded as they are read, so memory follows the object count rather than the export size
+func streamObjects(paths []string, domainFilter string) (map[string]*checkpoint.Node, []checkpoint.Gateway, error) {
+	l := checkpoint.NewObjectLoader(domainFilter, &hooks)
+	for _, p := range paths {
+		r, closer, err := openInput(p)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = l.Read(r)
+		closer()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+
+	objects, gateways := l.Objects()
+	return objects, gateways, nil
+}
+
+func loadGraph(p string) (map[string]*checkpoint.Node, []checkpoint.Gateway, error) {
+	r, closer, err := openInput(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closer()
+
+	objects, gateways, err := checkpoint.LoadGraph(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", p, err)
+	}
+
+	return objects, gateways, nil
+}
+
+func saveGraph(p string, objects map[string]*checkpoint.Node, gateways []checkpoint.Gateway) error {
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+
+	if err := checkpoint.SaveGraph(f, objects, gateways); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Exports are saved as <firewall>_<policy>.json, known is false when the name doesn't follow that
+func firewallName(p string) (firewall string, known bool) {
+	if p == stdinPath {
+		return "stdin", false
+	}
+
+	parts := strings.SplitN(path.Base(p), "_", 2)
+	return parts[0], len(parts) == 2
+}
+
+// NAT exports are often saved without the firewall in their name, their rules have no firewall then rather than the file name
+func loadNATSets(natPath string) ([]checkpoint.RuleSet, error) {
+	rules, err := readArray(natPath)
+	if err != nil {
+		return nil, err
+	}
+
+	firewall, known := firewallName(natPath)
+	if !known {
+		firewall = ""
+	}
+
+	return []checkpoint.RuleSet{{Firewall: firewall, Rules: rules}}, nil
+}
+
+func loadRuleSets(directory, aclsPath string) (sets []checkpoint.RuleSet, err error) {
+	paths := []string{aclsPath}
+	if aclsPath == "" {
+		paths, err = globAll(directory, "*Security-s116.json", "*Security-s116.json.gz")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range paths {
+		firewall, _ := firewallName(p)
+
+		rules, err := readArray(p)
+		if err != nil {
+			return nil, err
+		}
+
+		sets = append(sets, checkpoint.RuleSet{Firewall: firewall, Rules: rules})
+	}
+
+	return
+}
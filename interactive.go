@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+// Everything loaded once for the -interactive session
+type session struct {
+	allObjects map[string]*checkpoint.Node
+	namesMap   map[string][]string
+	gateways   []checkpoint.Gateway
+	rules      []checkpoint.ACLRule
+	natRules   []checkpoint.NATRule
+	opts       auditOptions
+	format     string
+	quiet      bool
+}
+
+const interactiveHelp = `Commands:
+	audit <name|uid>  audit an object
+	show <uid>        show a single object
+	find <substr>     search names and comments
+	help              show this
+	quit              exit`
+
+// Reads commands a line at a time until quit or the end of input, mistakes are reported and the session carries on
+func (s *session) run(r io.Reader) {
+	lines := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(os.Stderr, "> ")
+		if !lines.Scan() {
+			fmt.Fprint(os.Stderr, "\n")
+			break
+		}
+
+		command, arg := cutCommand(lines.Text())
+		switch command {
+		case "":
+		case "audit":
+			s.audit(arg)
+		case "show":
+			s.show(arg)
+		case "find":
+			if arg == "" {
+				fmt.Fprintln(os.Stderr, "find needs something to search for")
+				continue
+			}
+
+			_, rows := searchObjects(s.allObjects, arg)
+			printSearch(arg, rows, s.format)
+		case "help":
+			fmt.Fprintln(os.Stderr, interactiveHelp)
+		case "quit", "exit":
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command %s, try help\n", command)
+		}
+	}
+
+	check(lines.Err())
+}
+
+func cutCommand(line string) (command, arg string) {
+	line = strings.TrimSpace(line)
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) == 2 {
+		arg = strings.TrimSpace(parts[1])
+	}
+
+	return strings.ToLower(parts[0]), arg
+}
+
+// Names first, as that is what the -t flag takes, then uids
+func (s *session) lookup(nameOrUid string) *checkpoint.Node {
+	keys := s.namesMap[nameOrUid]
+	if len(keys) == 1 {
+		return s.allObjects[keys[0]]
+	}
+
+	if len(keys) > 1 {
+		fmt.Fprintf(os.Stderr, "%s is ambiguous, pick one by uid:\n", nameOrUid)
+		for _, key := range keys {
+			n := s.allObjects[key]
+			fmt.Fprintf(os.Stderr, "\t%s (%s) %s\n", n.Uid, n.Type, strings.TrimSpace(n.IPv4+" "+n.IPv6))
+		}
+		return nil
+	}
+
+	key := checkpoint.ResolveRef(s.allObjects, checkpoint.IndexByUid(s.allObjects), "", nameOrUid)
+	if n, ok := s.allObjects[key]; ok {
+		return n
+	}
+
+	fmt.Fprintf(os.Stderr, "Object %s not found\n", nameOrUid)
+	return nil
+}
+
+func (s *session) audit(nameOrUid string) {
+	n := s.lookup(nameOrUid)
+	if n == nil {
+		return
+	}
+
+	results, _ := auditTarget(n.Name, n, s.allObjects, s.gateways, s.rules, s.natRules, s.opts)
+	results.quiet = s.quiet
+	results.output(s.format)
+}
+
+func (s *session) show(uid string) {
+	key := checkpoint.ResolveRef(s.allObjects, checkpoint.IndexByUid(s.allObjects), "", uid)
+	n, ok := s.allObjects[key]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "No object with uid %s\n", uid)
+		return
+	}
+
+	row := membershipRow{
+		Name:    n.Name,
+		Type:    n.Type,
+		Extra:   objectExtra(n, s.allObjects),
+		Comment: strings.TrimSpace(n.Comments),
+		UID:     n.Uid,
+		Domain:  string(n.Domain),
+	}
+
+	sec := section{Key: "object", Title: "Object " + n.Uid, Headers: []string{"Name", "Type", "Extra", "Comment", "UID", "Domain"}}
+	sec.Rows = append(sec.Rows, [][]string{cell(row.Name), cell(row.Type), cell(row.Extra), cell(row.Comment), cell(row.UID), cell(row.Domain)})
+
+	printSection(s.format, sec, []membershipRow{row})
+}
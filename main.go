@@ -1,177 +1,592 @@
 package main
 
 import (
-	"bytes"
-	"crypto/md5"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net"
-	"path"
-	"path/filepath"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/NHAS/checkpoint-audit/checkpoint"
 	"github.com/NHAS/checkpoint-audit/table"
 )
 
-type Node struct {
-	Uid      string
-	Name     string
-	Comments string
-	Type     string
+// Exit codes, errors exit with 1 through log.Fatal
+const (
+	exitOK          = 0
+	exitAccessFound = 2
+	exitUnexpected  = 3
+)
+
+func check(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
-	IPv4          string `json:"ipv4-address"`
-	SubnetAddress string `json:"subnet4"`
-	MaskLength    int    `json:"mask-length4"`
-	Port          string
-	Protocol      string
-	Members       []string
+type targetList []string
 
-	Edges []*Edge
+func (t *targetList) String() string {
+	return strings.Join(*t, ",")
 }
 
-func (n *Node) Hash() string {
-	return fmt.Sprintf("%s", md5.Sum([]byte(n.Uid+n.Name+n.Type+n.IPv4+n.SubnetAddress+n.Port+n.Protocol)))
+func (t *targetList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*t = append(*t, name)
+		}
+	}
+	return nil
 }
 
-type Edge struct {
-	Start  *Node
-	End    *Node
-	Method string
+type auditOptions struct {
+	maxDepth        int
+	childrenOnly    bool
+	checkRules      bool
+	includeDisabled bool
+	explain         bool
+	sortBy          string
+	modifiedSince   time.Time
+	wide            bool
+	checkNAT        bool
+	//Hosts only belong to their most specific network
+	strictNetwork bool
+	//One rule table with the direction of each rule
+	combined bool
+	//Object types listed in the belongs to table, all when empty
+	belongsTypes []string
+	//Only objects with this tag are listed in the belongs to table
+	tag string
+	//Keep the export JSON of each matched rule
+	raw bool
+	//Only the target itself, no groups or networks and no Any
+	noExpand bool
+	//Belongs to table columns, all when empty
+	columns []string
+	//Shared between targets, nil walks the graph every time
+	associations *checkpoint.AssociationCache
 }
 
-type ACLRule struct {
-	Firewall    string `json:"-"`
-	Action      string
-	Name        string
-	SrcNegate   bool `json:"source-negate"`
-	DstNegate   bool `json:"destination-negate"`
-	Comments    string
-	Source      []string
-	Destination []string
-	Type        string
-	Enabled     bool
-	Number      int `json:"rule-number"`
-	Service     []string
+// Set by -verbose, logs the rules left out of reports and why
+var verbose bool
+
+// Passed to the checkpoint package when loading and matching, set up from -verbose and -progress. Export problems are always logged
+var hooks = checkpoint.Hooks{Warn: func(msg string) { log.Print(msg) }}
+
+func logSkipped(acl checkpoint.ACLRule, reason string) {
+	if !verbose {
+		return
+	}
+
+	//Sections and other entries that aren't rules have no number
+	if acl.Number == 0 {
+		log.Printf("%s %q on %s skipped: %s", acl.Type, acl.Name, acl.Firewall, reason)
+		return
+	}
+
+	log.Printf("Rule %d on %s skipped: %s", acl.Number, acl.Firewall, reason)
 }
 
-type Interface struct {
-	Address    string `json:"ipv4-address"`
-	MaskLength int    `json:"ipv4-mask-length"`
-	Name       string `json:"interface-name"`
-	Dynamic    bool   `json:"dynamic-ip"`
+// Action names that let traffic through, e.g localized names or layer actions. Compared case insensitively
+var acceptActions = []string{"Accept"}
+
+// Action object uids that let traffic through whatever they are named, for sites that rename or duplicate their accept action
+var acceptUids = make(map[string]bool)
+
+func isAcceptName(action string) bool {
+	for _, a := range acceptActions {
+		if strings.EqualFold(a, action) {
+			return true
+		}
+	}
+
+	return false
 }
 
-type Gateway struct {
-	Address    string `json:"ipv4-address"`
-	Name       string
-	Uid        string
-	Interfaces []Interface
+func isAccept(action *checkpoint.Node) bool {
+	return acceptUids[action.Uid] || isAcceptName(action.Name)
 }
 
-func (g *Gateway) Belongs(ip net.IP) string {
+// A mistyped uid would otherwise quietly accept nothing
+func warnUnknownAcceptUids(objects map[string]*checkpoint.Node) {
+	index := checkpoint.IndexByUid(objects)
+	for uid := range acceptUids {
+		if len(index[uid]) == 0 {
+			log.Printf("Accept action %s given with -accept-uids is not in the objects", uid)
+		}
+	}
+}
 
-	for _, i := range g.Interfaces {
-		rangeString := fmt.Sprintf("%s/%d", i.Address, i.MaskLength)
-		_, network, err := net.ParseCIDR(rangeString)
-		check(err)
+func acceptingOnly(rules []checkpoint.ACLRule, allObjects map[string]*checkpoint.Node) (accepting []checkpoint.ACLRule) {
+	for _, acl := range rules {
+		action := checkpoint.Lookup(allObjects, acl.Action)
+		if !isAccept(action) {
+			logSkipped(acl, "action "+action.Name+" is not an accept action")
+			continue
+		}
+
+		accepting = append(accepting, acl)
+	}
 
-		if network.Contains(ip) {
-			return rangeString
+	return
+}
+
+func withAction(rules []checkpoint.ACLRule, allObjects map[string]*checkpoint.Node, action string) (matching []checkpoint.ACLRule) {
+	for _, acl := range rules {
+		name := checkpoint.Lookup(allObjects, acl.Action).Name
+		if !strings.EqualFold(name, action) {
+			logSkipped(acl, "action "+name+" is not "+action)
+			continue
 		}
 
+		matching = append(matching, acl)
 	}
 
-	return ""
+	return
 }
 
-func Bidirectional(n1 *Node, n2 *Node) {
-	to := Edge{Start: n1, End: n2, Method: "Di"}
-	from := Edge{Start: n2, End: n1, Method: "Di"}
+// Layers are often not in the objects export, fall back to the layer reference itself then
+func layerName(acl checkpoint.ACLRule, allObjects map[string]*checkpoint.Node) string {
+	if acl.Layer == "" {
+		return "default"
+	}
+
+	if n, ok := allObjects[acl.Layer]; ok {
+		return n.Name
+	}
 
-	n1.Edges = append(n1.Edges, &to)
-	n2.Edges = append(n2.Edges, &from)
+	return acl.Layer
 }
 
-func Monodirectional(to *Node, from *Node) {
-	e := Edge{Start: from, End: to, Method: "Mono"}
+func withLayer(rules []checkpoint.ACLRule, allObjects map[string]*checkpoint.Node, layer string) (matching []checkpoint.ACLRule) {
+	for _, acl := range rules {
+		name := layerName(acl, allObjects)
+		if !strings.EqualFold(name, layer) {
+			logSkipped(acl, "layer "+name+" is not "+layer)
+			continue
+		}
+
+		matching = append(matching, acl)
+	}
 
-	to.Edges = append(to.Edges, &e)
-	from.Edges = append(from.Edges, &e)
+	return
 }
 
-func check(err error) {
-	if err != nil {
-		log.Fatal(err)
+// Rules that never matched traffic, exports without hit counts have none of these
+func withoutHits(rules []checkpoint.ACLRule) (unhit []checkpoint.ACLRule) {
+	for _, acl := range rules {
+		if acl.Hits == nil || acl.Hits.Value != 0 {
+			logSkipped(acl, "has hits")
+			continue
+		}
+
+		unhit = append(unhit, acl)
 	}
+
+	return
 }
 
-func loadObjects(paths []string) (names map[string]string, objects map[string]*Node, gateways []Gateway) {
+// Rules naming the object itself, rather than reaching it through Any or a negated side
+func directOnly(rules []checkpoint.ACLRule, allObjects map[string]*checkpoint.Node) (direct []checkpoint.ACLRule) {
+	for _, acl := range rules {
+		if acl.MatchedBy == "" || checkpoint.IsAnyObject(checkpoint.Lookup(allObjects, acl.MatchedBy)) {
+			logSkipped(acl, "does not reference the target directly")
+			continue
+		}
 
-	groups := []*Node{}
-	networks := []*Node{}
-	hosts := []*Node{}
+		direct = append(direct, acl)
+	}
 
-	names = make(map[string]string)
-	objects = make(map[string]*Node)
+	return
+}
 
-	for _, path := range paths {
+// Enabled accept rules granting access that aren't in the expected rule numbers
+func unexpectedAccess(rows []ruleRow, expected map[int]bool) []ruleRow {
+	unexpected := []ruleRow{}
+	for _, row := range rows {
+		if !row.Disabled && row.accept && !expected[row.Number] {
+			unexpected = append(unexpected, row)
+		}
+	}
 
-		objs, err := ioutil.ReadFile(path)
-		check(err)
+	return unexpected
+}
 
-		var jsonObjects []json.RawMessage
-		check(json.Unmarshal(objs, &jsonObjects))
+// Rule numbers are only unique within a layer of a firewall's rulebase
+func ruleKey(acl checkpoint.ACLRule) string {
+	return fmt.Sprintf("%s/%s/%d", acl.Firewall, acl.Layer, acl.Number)
+}
+
+// The same rulebase can be loaded twice, e.g overlapping globs or repeated pages of an export, each rule is only shown once
+func uniqueRules(rules []checkpoint.ACLRule) (unique []checkpoint.ACLRule) {
+	seen := make(map[string]bool)
+	for _, acl := range rules {
+		if seen[ruleKey(acl)] {
+			continue
+		}
+		seen[ruleKey(acl)] = true
 
-		//Populate all objects
-		for _, v := range jsonObjects {
-			var n Node
-			check(json.Unmarshal(v, &n))
+		unique = append(unique, acl)
+	}
 
-			if _, ok := objects[n.Uid]; ok && n.Type != "CpmiVsClusterNetobj" {
-				if n.Hash() != objects[n.Uid].Hash() {
-					log.Fatalf("Nodes not equal\n%v\n%v", n, objects[n.Uid])
-				}
+	return
+}
+
+func enabledOnly(rules []checkpoint.ACLRule) (enabled []checkpoint.ACLRule) {
+	for _, acl := range rules {
+		if acl.Enabled {
+			enabled = append(enabled, acl)
+		}
+	}
+
+	return
+}
+
+func hasAny(uids []string, allObjects map[string]*checkpoint.Node) bool {
+	for _, uid := range uids {
+		if checkpoint.IsAnyObject(checkpoint.Lookup(allObjects, uid)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Walks the traversal parents back from the matching object to the target
+func explainMatch(acl checkpoint.ACLRule, allObjects map[string]*checkpoint.Node, parents map[*checkpoint.Node]*checkpoint.Node) []string {
+	if acl.MatchedBy == "" {
+		return []string{"not in negated objects"}
+	}
+
+	n := checkpoint.Lookup(allObjects, acl.MatchedBy)
+	if _, reached := parents[n]; !reached {
+		return []string{"via " + n.Name}
+	}
+
+	var chain []string
+	for ; n != nil; n = parents[n] {
+		chain = append([]string{n.Name}, chain...)
+	}
+
+	return []string{strings.Join(chain, " -> ")}
+}
+
+// URLs the rule's application services match, one line per application that lists any
+func applicationURLs(acl checkpoint.ACLRule, allObjects map[string]*checkpoint.Node) (lines []string) {
+	for _, serv := range expandServices(acl.Service, allObjects, make(map[string]bool)) {
+		if isApplication(serv) && len(serv.URLList) != 0 {
+			lines = append(lines, serv.Name+" urls: "+strings.Join(serv.URLList, ", "))
+		}
+	}
+
+	return
+}
+
+// Extra column of the belongs to table, what the object covers
+func objectExtra(n *checkpoint.Node, allObjects map[string]*checkpoint.Node) (extra string) {
+	switch n.Type {
+	case "host":
+		extra = strings.TrimSpace(n.IPv4 + "\n" + n.IPv6)
+	case "network":
+		var ranges []string
+		for _, r := range n.Ranges() {
+			ranges = append(ranges, r.String())
+		}
+		extra = strings.Join(ranges, "\n")
+	case "address-range":
+		extra = n.RangeFirst + "-" + n.RangeLast
+	case "group":
+		extra = fmt.Sprintf("Members %d", len(n.Members))
+	case "dns-domain":
+		extra = "DNS domain match, not an address"
+		if n.IsSubDomain {
+			extra = "DNS domain and sub-domains match, not an address"
+		}
+	case checkpoint.UpdatableObjectType:
+		extra = "Updatable object, addresses come from a feed and aren't in the export"
+	case checkpoint.DynamicObjectType:
+		extra = "Dynamic object, addresses are resolved on the gateway"
+	case "group-with-exclusion":
+		extra = "Include " + checkpoint.Lookup(allObjects, string(n.Include)).Name + "\nExcept " + checkpoint.Lookup(allObjects, string(n.Except)).Name
+	}
+
+	return
+}
+
+// Targets are audited on up to jobs goroutines, the objects and rules are only read once loaded. Results are in the order of keys
+func auditAll(keys []string, jobs int, audit func(key string) (*report, []*checkpoint.Node)) (reports []*report, associated [][]*checkpoint.Node) {
+	reports = make([]*report, len(keys))
+	associated = make([][]*checkpoint.Node, len(keys))
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				reports[i], associated[i] = audit(keys[i])
+			}
+		}()
+	}
+
+	for i := range keys {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
 
+	return
+}
+
+func shownType(objectType string, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+
+	for _, t := range types {
+		if strings.EqualFold(t, objectType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func auditTarget(name string, targetObject *checkpoint.Node, allObjects map[string]*checkpoint.Node, gateways []checkpoint.Gateway, rules []checkpoint.ACLRule, natRules []checkpoint.NATRule, opts auditOptions) (results *report, associatedNodes []*checkpoint.Node) {
+	var parents map[*checkpoint.Node]*checkpoint.Node
+	switch {
+	case opts.noExpand:
+		associatedNodes, parents = []*checkpoint.Node{targetObject}, map[*checkpoint.Node]*checkpoint.Node{targetObject: nil}
+	case opts.childrenOnly:
+		associatedNodes, parents = checkpoint.AllChildren(targetObject, opts.maxDepth)
+	case opts.associations != nil && opts.strictNetwork:
+		associatedNodes, parents = opts.associations.StrictPermissionGroups(targetObject, opts.maxDepth)
+	case opts.associations != nil:
+		associatedNodes, parents = opts.associations.PermissionGroups(targetObject, opts.maxDepth)
+	case opts.strictNetwork:
+		associatedNodes, parents = checkpoint.StrictPermissionGroups(targetObject, opts.maxDepth)
+	default:
+		associatedNodes, parents = checkpoint.PermissionGroups(targetObject, opts.maxDepth)
+	}
+
+	results = newReport(name)
+	results.showModified = !opts.modifiedSince.IsZero()
+	results.columns = opts.columns
+
+	if targetObject.Type == "network" || targetObject.Type == "host" {
+
+		var ipaddress net.IP
+		switch targetObject.Type {
+		case "network":
+			if targetObject.SubnetAddress != "" {
+				ipaddress = net.ParseIP(targetObject.SubnetAddress)
+			}
+		case "host":
+			ipaddress = net.ParseIP(targetObject.IPv4)
+		}
+
+		results.hasGateways = true
+		for _, g := range gateways {
+			rangeString, err := g.Belongs(ipaddress)
+			check(err)
+
+			if rangeString != "" {
+				results.Gateways = append(results.Gateways, gatewayRow{Name: g.Name, Range: rangeString, UID: g.Uid})
+			}
+		}
+	}
+
+	for _, currentNode := range associatedNodes {
+		if !shownType(currentNode.Type, opts.belongsTypes) || (opts.tag != "" && !currentNode.HasTag(opts.tag)) {
+			continue
+		}
+
+		extraData := objectExtra(currentNode, allObjects)
+
+		results.BelongsTo = append(results.BelongsTo, membershipRow{
+			Name:    currentNode.Name,
+			Type:    currentNode.Type,
+			Extra:   extraData,
+			Comment: strings.TrimSpace(currentNode.Comments),
+			UID:     currentNode.Uid,
+			Domain:  string(currentNode.Domain),
+
+			Modified: modifiedAfter(currentNode, opts.modifiedSince),
+		})
+	}
+
+	if opts.checkNAT {
+		results.hasNAT = true
+		results.NAT = buildNATRows(checkpoint.TranslatingNAT(associatedNodes, natRules), allObjects)
+	}
+
+	if !opts.checkRules {
+		return
+	}
+
+	accessTo, accessFrom, intra := checkpoint.Classify(associatedNodes, allObjects, rules, &hooks)
+	accessTo, accessFrom, intra = uniqueRules(accessTo), uniqueRules(accessFrom), uniqueRules(intra)
+
+	if opts.noExpand {
+		accessTo, accessFrom = directOnly(accessTo, allObjects), directOnly(accessFrom, allObjects)
+
+		//Intra rules have to name the target on both sides
+		from := make(map[string]bool)
+		for _, acl := range accessFrom {
+			from[ruleKey(acl)] = true
+		}
+
+		var both []checkpoint.ACLRule
+		for _, acl := range directOnly(intra, allObjects) {
+			if from[ruleKey(acl)] {
+				both = append(both, acl)
+			}
+		}
+		intra = both
+	}
+
+	//Rules can be in both lists, intra target ones and those with Any on both sides, so only count them once
+	counted := make(map[string]bool)
+	for _, list := range [][]checkpoint.ACLRule{accessTo, accessFrom} {
+		for _, acl := range list {
+			key := ruleKey(acl)
+			if counted[key] {
 				continue
 			}
+			counted[key] = true
 
-			objects[n.Uid] = &n
-
-			switch n.Type {
-			case "host":
-				hosts = append(hosts, &n)
-			case "group", "service-group":
-				groups = append(groups, &n)
-			case "network":
-				networks = append(networks, &n)
-			case "CpmiVsClusterNetobj":
-				var g Gateway
-				check(json.Unmarshal(v, &g))
-				gateways = append(gateways, g)
+			if acl.Enabled {
+				results.Summary.Enabled++
+			} else {
+				results.Summary.Disabled++
 			}
+		}
+	}
 
-			names[n.Name] = n.Uid
+	if !opts.includeDisabled {
+		//Rules in both lists are only logged once
+		logged := make(map[string]bool)
+		for _, acl := range append(accessTo, accessFrom...) {
+			key := ruleKey(acl)
+			if !acl.Enabled && !logged[key] {
+				logged[key] = true
+				logSkipped(acl, "disabled")
+			}
 		}
+
+		accessTo = enabledOnly(accessTo)
+		accessFrom = enabledOnly(accessFrom)
+		intra = enabledOnly(intra)
 	}
 
-	//Dereference objects and populate groups
-	for g := range groups {
-		for _, m := range groups[g].Members {
-			Monodirectional(objects[m], groups[g])
+	explained := func(list []checkpoint.ACLRule) []ruleRow {
+		rows := buildRows(list, allObjects)
+
+		if opts.explain {
+			for i, acl := range list {
+				rows[i].Explain = append(explainMatch(acl, allObjects, parents), applicationURLs(acl, allObjects)...)
+			}
 		}
+
+		if opts.raw {
+			for i, acl := range list {
+				rows[i].Raw = acl.Raw
+			}
+		}
+
+		return rows
 	}
 
-	for n := range networks {
-		for h := range hosts {
-			_, netRange, err := net.ParseCIDR(fmt.Sprintf("%s/%d", networks[n].SubnetAddress, networks[n].MaskLength))
-			check(err)
+	toRows := func(list []checkpoint.ACLRule) []ruleRow {
+		rows := explained(list)
+
+		if opts.sortBy != "" {
+			sortRows(rows, opts.sortBy)
+		}
 
-			if netRange.Contains(net.ParseIP(hosts[h].IPv4)) {
-				Bidirectional(hosts[h], networks[n])
+		return rows
+	}
+
+	results.rulesChecked = true
+	results.showDisabled = opts.includeDisabled
+	results.showExplain = opts.explain
+	for _, acl := range rules {
+		if acl.Hits != nil {
+			//Exports have counts for every rule or for none
+			results.showHits = true
+			break
+		}
+	}
+	results.wide = opts.wide
+	results.AccessTo = toRows(accessTo)
+	results.AccessFrom = toRows(accessFrom)
+	results.Intra = toRows(intra)
+	results.Protocols = protocolCounts(results.AccessFrom)
+
+	if opts.combined {
+		results.combined = true
+
+		//Rules with the target as the source first, so those matching both ways keep their source side explanation
+		dirs := make(map[string]string)
+		var merged []checkpoint.ACLRule
+		for _, acl := range accessTo {
+			dirs[ruleKey(acl)] = "target->"
+			merged = append(merged, acl)
+		}
+		for _, acl := range accessFrom {
+			if _, ok := dirs[ruleKey(acl)]; ok {
+				dirs[ruleKey(acl)] = "Both"
+				continue
 			}
+			dirs[ruleKey(acl)] = "->target"
+			merged = append(merged, acl)
+		}
+
+		rows := explained(merged)
+		for i, acl := range merged {
+			rows[i].Dir = dirs[ruleKey(acl)]
+		}
+
+		sortBy := opts.sortBy
+		if sortBy == "" {
+			sortBy = "number"
+		}
+		sortRows(rows, sortBy)
+
+		results.Rules = rows
+	}
+
+	for _, acl := range append(accessTo, accessFrom...) {
+		results.anySource = results.anySource || hasAny(acl.Source, allObjects)
+		results.anyDestination = results.anyDestination || hasAny(acl.Destination, allObjects)
+	}
+
+	var anySource, anyDestination []checkpoint.ACLRule
+	for _, acl := range acceptingOnly(accessFrom, allObjects) {
+		if hasAny(acl.Source, allObjects) && !acl.SrcNegate {
+			anySource = append(anySource, acl)
+		}
+	}
+	for _, acl := range acceptingOnly(accessTo, allObjects) {
+		if hasAny(acl.Destination, allObjects) && !acl.DstNegate {
+			anyDestination = append(anyDestination, acl)
+		}
+	}
+	results.AnySourceRules = toRows(anySource)
+	results.AnyDestinationRules = toRows(anyDestination)
+
+	if opts.combined {
+		for i := range results.AnySourceRules {
+			results.AnySourceRules[i].Dir = "->target"
+		}
+		for i := range results.AnyDestinationRules {
+			results.AnyDestinationRules[i].Dir = "target->"
 		}
 	}
 
@@ -180,278 +595,822 @@ func loadObjects(paths []string) (names map[string]string, objects map[string]*N
 
 func main() {
 
+	var targets targetList
+	var uids targetList
+
 	directory := flag.String("path", "", "Path to checkpoint exported resources")
-	target := flag.String("t", "", "Target node (by name)")
+	flag.Var(&targets, "t", "Target node (by name), may be repeated or comma separated")
+	flag.Var(&uids, "uid", "Target node by uid, may be repeated or comma separated, takes precedence over -t")
 	assocOnly := flag.Bool("g", false, "Associated groups/nodes/networks only, i.e dont find firewall rules")
 	childrenOnly := flag.Bool("c", false, "Get all children BFS")
+	rawRules := flag.Bool("raw", false, "Print the export JSON of each matched rule after the tables")
+	noExpand := flag.Bool("no-expand", false, "Only match rules that name the target itself, not its groups and networks or Any")
+	maxDepth := flag.Int("depth", -1, "Maximum hops from the target to traverse, negative for unlimited")
+	dotPath := flag.String("dot", "", "Write the graph of nodes reachable from the targets to this file in Graphviz DOT format")
+	format := flag.String("format", "table", "Output format (table, json, csv, tsv, markdown), json with several targets is an array of their reports")
+	objsPath := flag.String("objs", "", "Objects exports to use instead of searching -path, comma separated files or globs, - reads from stdin")
+	aclsPath := flag.String("acls", "", "Access rules export to use instead of searching -path, - reads from stdin")
+	includeDisabled := flag.Bool("include-disabled", false, "Include disabled rules in the access tables")
+	explain := flag.Bool("explain", false, "Show the membership chain that made each rule match the target")
+	quiet := flag.Bool("quiet", false, "Skip tables without any rows")
+	countOnly := flag.Bool("count-only", false, "Only print how many groups the target belongs to and how many rules allow access to and from it")
+	sortBy := flag.String("sort", "", "Sort the access tables by number, src, dst, service or hits")
+	zeroHits := flag.Bool("zero-hits", false, "Only show rules with a hit count of zero, rules without counts are left out")
+	serviceValue := flag.String("service", "", "Only show rules allowing this service, as protocol/port (e.g tcp/443) or just protocol")
+	action := flag.String("action", "", "Only show rules with this action (e.g Accept, Drop, Reject)")
+	var expectedNumbers targetList
+	flag.Var(&expectedNumbers, "expected", "Rule numbers allowed to grant access to the target, comma separated. Any other enabled accept rule is listed as unexpected and the exit code is 3")
+	failIfAccess := flag.Bool("fail-if-access", false, "Exit with 2 if any accept rule grants access to a target (0 no access, 1 error)")
+	var accepts targetList
+	flag.Var(&accepts, "accept-actions", "Actions that allow traffic, comma separated and case insensitive (default Accept)")
+	var acceptUidList targetList
+	flag.Var(&acceptUidList, "accept-uids", "Action object uids that allow traffic whatever they are named, comma separated. Used on top of -accept-actions")
+	var columns targetList
+	flag.Var(&columns, "columns", "Columns of the belongs to table and their order, comma separated from "+strings.Join(belongsColumns, ", "))
+	var belongsTypes targetList
+	flag.Var(&belongsTypes, "belongs-types", "Only list these object types in the belongs to table, comma separated (e.g group,network). Rules still use every association")
+	htmlPath := flag.String("html", "", "Also write the target reports to this file as HTML")
+	domain := flag.String("domain", "", "Only audit objects and rules from this Multi-Domain Server domain (and Global)")
+	cidrValue := flag.String("cidr", "", "Target everything in this subnet, e.g 10.1.2.0/24, as if it were a network object")
+	resolveName := flag.String("resolve", "", "Print everything known about this object, its groups, the networks containing it and its raw JSON")
+	ipAddress := flag.String("ip", "", "Target the host with this address, or the most specific network or address range containing it")
+	overlaps := flag.Bool("overlaps", false, "Report network objects that are identical to or contain another, does not need a target")
+	validate := flag.Bool("validate", false, "Check the objects export for unresolved members and bad addresses then exit, does not need a target")
+	tag := flag.String("tag", "", "Only list objects with this tag in the belongs to table and -unused")
+	tagMismatches := flag.Bool("tag-mismatches", false, "Report objects that share no tag with a group they are in, e.g dev hosts in prod groups, does not need a target")
+	unused := flag.Bool("unused", false, "Report host, network and group objects no rule references, does not need a target")
+	flag.BoolVar(&prettyJSON, "json-pretty", false, "Indent -format json output")
+	flag.IntVar(&topRows, "top", 0, "Only show the first N rows of each table, after sorting. 0 shows them all")
+	flag.IntVar(&maxCellWidth, "max-width", 0, "Truncate table cells wider than this many characters, 0 for no limit")
+	color := flag.String("color", "auto", "Color rules by action in tables (auto, always, never), auto only colors terminals")
+	srcName := flag.String("src", "", "With -dst, report whether any enabled accept rule lets anything under this object reach anything under -dst")
+	dstName := flag.String("dst", "", "Destination object for -src")
+	warnCyclic := flag.Bool("warn-cycles", false, "Warn on stderr about groups that contain themselves through their members")
+	modifiedValue := flag.String("modified-since", "", "Mark objects in the belongs to and unused reports changed after this date (YYYY-MM-DD)")
+	wide := flag.Bool("wide", false, "Split the service column into name, protocol and port columns")
+	summaryPath := flag.String("summary", "", "Append a one line JSON summary per target to this file")
+	layer := flag.String("layer", "", "Only show rules from this policy layer, rules without one are in \"default\"")
+	search := flag.String("search", "", "List objects with this in their name or comments (case insensitive), does not need a target")
+	auditMatches := flag.Bool("audit-matches", false, "With -search, also audit every matching object")
+	natPath := flag.String("nat", "", "NAT rules export, adds a table of the NAT rules translating each target")
+	showProgress := flag.Bool("progress", false, "Write progress on loading and rule matching to stderr")
+	redundant := flag.Bool("redundant", false, "Report enabled rules with the same action, source, destination and service once groups are expanded, does not need a target")
+	shadowed := flag.Bool("shadowed", false, "Report rules shadowed by an earlier rule with the same action, does not need a target")
+	diffObjs := flag.String("diff-objs", "", "Objects export of an earlier snapshot, with -diff-acls shows the rules added and removed for the -t target since then")
+	diffAcls := flag.String("diff-acls", "", "Rulebase export of the earlier snapshot for -diff-objs")
+	strictNetwork := flag.Bool("strict-network", false, "Only associate hosts with the most specific network containing them, not every supernet")
+	flag.BoolVar(&verbose, "verbose", false, "Log every rule left out of the report and why to stderr")
+	graphOut := flag.String("graph-out", "", "Save the built object graph to this file, for -graph-in")
+	graphIn := flag.String("graph-in", "", "Load the object graph saved with -graph-out instead of reading and linking the objects exports")
+	networkHierarchy := flag.Bool("network-hierarchy", false, "Make networks members of the networks containing them, so networks belong to their supernets")
+	zonesPath := flag.String("zones", "", "JSON file mapping security zone names to the hosts and networks in them, so zone based rules match")
+	combinedView := flag.Bool("combined", false, "Show one rule table sorted by number with the direction of each rule, instead of the access and intra-target tables")
+	jobs := flag.Int("jobs", 1, "Audit this many targets at once, the reports are still printed in target order")
+	showVersion := flag.Bool("version", false, "Print the version and commit of this build and exit")
+	interactive := flag.Bool("interactive", false, "Load the exports once then read audit, show, find and quit commands from stdin")
+	outPath := flag.String("o", "", "Write the report to this file instead of stdout, warnings and progress stay on stderr")
 
 	flag.Parse()
 
-	matches, err := filepath.Glob(path.Join(*directory, "*_objects.json"))
-	check(err)
+	if *showVersion {
+		fmt.Println("checkpoint-audit " + versionString())
+		return
+	}
 
-	namesMap, allObjects, gateways := loadObjects(matches)
+	if !validFormat(*format) {
+		log.Fatalf("Unknown output format %s", *format)
+	}
 
-	if *target == "" {
-		for n := range namesMap {
-			fmt.Println(n)
+	if !validSort(*sortBy) {
+		log.Fatalf("Unknown sort order %s", *sortBy)
+	}
+
+	mode, err := table.ParseColorMode(*color)
+	check(err)
+	colorMode = mode
+
+	var modifiedSince time.Time
+	if *modifiedValue != "" {
+		modifiedSince, err = time.Parse("2006-01-02", *modifiedValue)
+		if err != nil {
+			log.Fatalf("Invalid -modified-since date %s, expected YYYY-MM-DD", *modifiedValue)
 		}
-		return
 	}
 
-	targetObject, ok := allObjects[namesMap[*target]]
-	if !ok {
-		log.Fatalf("Target %s not found", *target)
+	if len(accepts) != 0 {
+		acceptActions = accepts
 	}
 
-	var associatedNodes []*Node
-	if !*childrenOnly {
-		associatedNodes = getPermissionGroups(targetObject)
-	} else {
-		associatedNodes = getAllChildren(targetObject)
+	for _, uid := range acceptUidList {
+		acceptUids[uid] = true
 	}
 
-	if targetObject.Type == "network" || targetObject.Type == "host" {
+	if maxCellWidth < 0 {
+		log.Fatalf("Invalid -max-width %d", maxCellWidth)
+	}
 
-		var ipaddress net.IP
-		switch targetObject.Type {
-		case "network":
-			ipaddress, _, err = net.ParseCIDR(fmt.Sprintf("%s/%d", targetObject.SubnetAddress, targetObject.MaskLength))
-			check(err)
-		case "host":
-			ipaddress = net.ParseIP(targetObject.IPv4)
+	if *jobs < 1 {
+		log.Fatalf("Invalid -jobs %d", *jobs)
+	}
+
+	for _, c := range columns {
+		known := false
+		for _, b := range belongsColumns {
+			known = known || strings.EqualFold(c, b)
+		}
+
+		if !known {
+			log.Fatalf("Unknown -columns column %s, expected one of %s", c, strings.Join(belongsColumns, ", "))
+		}
+	}
+
+	var expected map[int]bool
+	if len(expectedNumbers) != 0 {
+		expected = make(map[int]bool)
+		for _, value := range expectedNumbers {
+			number, err := strconv.Atoi(value)
+			if err != nil || number < 1 {
+				log.Fatalf("Invalid -expected rule number %s", value)
+			}
+			expected[number] = true
 		}
+	}
 
-		t, err := table.NewTable("Egress Gateways", "Name", "Matching Range", "UID")
+	if topRows < 0 {
+		log.Fatalf("Invalid -top %d", topRows)
+	}
+
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
 		check(err)
+		//Unbuffered, so nothing is lost when exiting with os.Exit or log.Fatal
+		out = f
+	}
 
-		for _, g := range gateways {
-			rangeString := g.Belongs(ipaddress)
-			if rangeString != "" {
-				t.AddValues(g.Name, rangeString, g.Uid)
+	if verbose {
+		hooks.Skipped = logSkipped
+	}
+
+	if *showProgress {
+		var last time.Time
+		var mu sync.Mutex
+		hooks.Progress = func(stage string, done, total int) {
+			//Targets audited with -jobs report from several goroutines
+			mu.Lock()
+			defer mu.Unlock()
+
+			//At most once a second, the last step of each stage is always shown
+			if done != total && time.Since(last) < time.Second {
+				return
 			}
+			last = time.Now()
+
+			//Streamed stages don't know their total until they are done
+			if total == 0 {
+				fmt.Fprintf(os.Stderr, "%s %d\n", stage, done)
+				return
+			}
+
+			fmt.Fprintf(os.Stderr, "%s %d/%d\n", stage, done, total)
 		}
+	}
+
+	//Both on stdin means a single stream with the objects and rules under their own keys
+	combined := *objsPath == stdinPath && *aclsPath == stdinPath
+
+	var objectSets [][]json.RawMessage
+	var combinedRules []json.RawMessage
+	if combined {
+		var objects []json.RawMessage
+		objects, combinedRules, err = readCombined(os.Stdin)
+		check(err)
 
-		t.Print()
+		objectSets = append(objectSets, objects)
+	} else if *validate {
+		objectSets, err = loadObjectSets(*directory, *objsPath)
+		check(err)
 	}
 
-	t, err := table.NewTable(*target+" Belongs To", "Name", "Type", "Extra", "Comment", "UID")
-	check(err)
+	//Runs on the raw objects, as building the graph stops on the first bad object
+	if *validate {
+		problems := validateObjects(objectSets, *domain)
+		printValidation(problems, *format)
+		if len(problems) != 0 {
+			os.Exit(1)
+		}
+		return
+	}
 
-	checkMap := make(map[string]bool)
+	var allObjects map[string]*checkpoint.Node
+	var gateways []checkpoint.Gateway
+	switch {
+	case *graphIn != "":
+		//Already built, and filtered to the domain it was saved with
+		allObjects, gateways, err = loadGraph(*graphIn)
+		check(err)
+	case combined:
+		allObjects, gateways, err = checkpoint.ParseObjects(objectSets, *domain, &hooks)
+		check(err)
+		check(checkpoint.BuildGraph(allObjects, &hooks))
+	default:
+		paths, err := objectPaths(*directory, *objsPath)
+		check(err)
 
-	for _, currentNode := range associatedNodes {
+		allObjects, gateways, err = streamObjects(paths, *domain)
+		check(err)
+		check(checkpoint.BuildGraph(allObjects, &hooks))
+	}
 
-		checkMap[currentNode.Uid] = true
+	if *zonesPath != "" {
+		zones, err := loadZones(*zonesPath)
+		check(err)
 
-		extraData := ""
-		switch currentNode.Type {
-		case "host":
-			extraData = currentNode.IPv4
-		case "network":
-			extraData = fmt.Sprintf("%s/%d", currentNode.SubnetAddress, currentNode.MaskLength)
-		case "group":
-			extraData = fmt.Sprintf("Members %d", len(currentNode.Members))
+		check(checkpoint.AddZones(allObjects, zones))
+	}
+
+	if *networkHierarchy {
+		checkpoint.AddNetworkHierarchy(allObjects)
+	}
+
+	if *graphOut != "" {
+		check(saveGraph(*graphOut, allObjects, gateways))
+	}
+
+	warnUnknownAcceptUids(allObjects)
+
+	namesMap := checkpoint.NameIndex(allObjects)
+	warnMalformedHosts(findMalformedHosts(allObjects))
+
+	if *warnCyclic {
+		warnCycles(findCycles(allObjects))
+	}
+
+	loadRules := func() []checkpoint.ACLRule {
+		var ruleSets []checkpoint.RuleSet
+		if combined {
+			ruleSets = append(ruleSets, checkpoint.RuleSet{Firewall: "stdin", Rules: combinedRules})
+		} else {
+			var err error
+			ruleSets, err = loadRuleSets(*directory, *aclsPath)
+			check(err)
 		}
 
-		t.AddValues(currentNode.Name, currentNode.Type, extraData, strings.TrimSpace(currentNode.Comments), currentNode.Uid)
+		rules, err := checkpoint.ParseRules(ruleSets, allObjects, *domain, &hooks)
+		check(err)
+
+		return rules
 	}
 
-	t.Print()
+	if *overlaps {
+		printOverlaps(findOverlaps(allObjects), *format)
+		return
+	}
+
+	if *unused {
+		printUnused(findUnused(loadRules(), allObjects, modifiedSince, *tag), *format, !modifiedSince.IsZero())
+		return
+	}
+
+	if *tagMismatches {
+		printTagMismatches(findTagMismatches(allObjects), *format)
+		return
+	}
+
+	if *shadowed {
+		printShadowed(findShadowed(enabledOnly(loadRules()), allObjects), *format)
+		return
+	}
+
+	if *redundant {
+		printRedundant(findRedundant(enabledOnly(loadRules()), allObjects), *format)
+		return
+	}
 
-	if *assocOnly || *childrenOnly {
+	if *srcName != "" || *dstName != "" {
+		if *srcName == "" || *dstName == "" {
+			log.Fatal("-src and -dst have to be used together")
+		}
+
+		src, dst := uniqueName(namesMap, allObjects, *srcName), uniqueName(namesMap, allObjects, *dstName)
+		printReachability(findReachable(src, dst, allObjects, loadRules()), *format)
 		return
 	}
 
-	matches, err = filepath.Glob(path.Join(*directory, "*Security-s116.json"))
+	if *diffObjs != "" || *diffAcls != "" {
+		if *diffObjs == "" || *diffAcls == "" {
+			log.Fatal("-diff-objs and -diff-acls have to be used together")
+		}
 
-	var accessTo []ACLRule
-	var accessFrom []ACLRule
+		if len(targets) != 1 {
+			log.Fatal("-diff-objs needs a single target given with -t")
+		}
 
-	for _, p := range matches {
-		aclBytes, err := ioutil.ReadFile(p)
+		paths, err := expandPaths(*diffObjs)
 		check(err)
 
-		var rules []json.RawMessage
-		check(json.Unmarshal(aclBytes, &rules))
-
-	OuterLoop:
-		for _, r := range rules {
-			if bytes.Contains(r, []byte("access-rule")) {
-				var acl ACLRule
-				check(json.Unmarshal(r, &acl))
-				if acl.Enabled {
-
-					acl.Firewall = strings.SplitN(path.Base(p), "_", 2)[0]
-
-					for _, uid := range acl.Source {
-						applies := doRuleApply(checkMap, allObjects, acl, uid)
-						//Xor If it applies and is not negated, and if it doesnt apply but is negated
-						if applies != acl.SrcNegate {
-							accessTo = append(accessTo, acl)
-							continue OuterLoop
-						}
-					}
-
-					for _, uid := range acl.Destination {
-						applies := doRuleApply(checkMap, allObjects, acl, uid)
-						if applies != acl.DstNegate {
-							accessFrom = append(accessFrom, acl)
-							continue OuterLoop
-						}
-					}
+		beforeObjects, _, err := streamObjects(paths, *domain)
+		check(err)
+		check(checkpoint.BuildGraph(beforeObjects, &hooks))
+		if *networkHierarchy {
+			checkpoint.AddNetworkHierarchy(beforeObjects)
+		}
 
-				}
-			}
+		beforeSets, err := loadRuleSets("", *diffAcls)
+		check(err)
+
+		beforeRules, err := checkpoint.ParseRules(beforeSets, beforeObjects, *domain, &hooks)
+		check(err)
+
+		afterRules := loadRules()
+		if !*includeDisabled {
+			beforeRules, afterRules = enabledOnly(beforeRules), enabledOnly(afterRules)
+		}
+
+		before := uniqueName(checkpoint.NameIndex(beforeObjects), beforeObjects, targets[0])
+		after := uniqueName(namesMap, allObjects, targets[0])
+		printDiff(diffAudits(before, after, beforeObjects, allObjects, beforeRules, afterRules), *format)
+		return
+	}
+
+	if *resolveName != "" {
+		//Only the exports have the raw objects, reading them again keeps the normal load streaming
+		if !combined {
+			objectSets, err = loadObjectSets(*directory, *objsPath)
+			check(err)
 		}
 
+		printResolution(resolveObject(uniqueName(namesMap, allObjects, *resolveName), allObjects, objectSets), *format)
+		return
 	}
 
-	fmt.Print("\n")
+	//Object keys of the targets to audit
+	var found []string
 
-	accessToTable, _ := table.NewTable(*target+"->Target", "Firewall", "No.", "Src", "Dst", "Service", "Action")
-	buildTable(&accessToTable, accessTo, allObjects)
-	accessToTable.Print()
+	if *ipAddress != "" {
+		ip := net.ParseIP(*ipAddress)
+		if ip == nil {
+			log.Fatalf("Invalid ip address %s", *ipAddress)
+		}
 
-	fmt.Print("\n")
+		match := findByIP(allObjects, ip)
+		if match == nil {
+			log.Fatalf("No host, network or address range contains %s", *ipAddress)
+		}
 
-	accessFromTable, _ := table.NewTable("Target->"+*target, "Firewall", "No.", "Src", "Dst", "Service", "Action")
-	buildTable(&accessFromTable, accessFrom, allObjects)
-	accessFromTable.Print()
+		if textFormat(*format) {
+			s := section{Key: "ip", Title: *ipAddress + " Resolves To", Headers: []string{"Name", "Type", "UID"}}
+			s.Rows = append(s.Rows, [][]string{cell(match.Name), cell(match.Type), cell(match.Uid)})
+			printSection(*format, s, nil)
+			fmt.Fprint(out, "\n")
+		}
 
-}
+		found = append(found, match.Key())
+	}
+
+	var cidrKey string
+	if *cidrValue != "" {
+		_, cidr, err := net.ParseCIDR(*cidrValue)
+		if err != nil {
+			log.Fatalf("Invalid -cidr %s", *cidrValue)
+		}
 
-func getAllChildren(n *Node) (children []*Node) {
-	visited := make(map[*Node]bool)
+		//Only in the objects while the targets are audited
+		n := cidrNode(allObjects, cidr)
+		cidrKey = n.Key()
+		allObjects[cidrKey] = n
+		found = append(found, cidrKey)
+	}
+
+	if *search != "" {
+		keys, rows := searchObjects(allObjects, *search)
+		if !*auditMatches {
+			printSearch(*search, rows, *format)
+			return
+		}
 
-	visited[n] = true
-	searchSpace := []*Node{n}
+		if textFormat(*format) {
+			printSearch(*search, rows, *format)
+			fmt.Fprint(out, "\n")
+		}
 
-	for len(searchSpace) != 0 {
-		currentNode := searchSpace[0]
-		children = append(children, currentNode)
-		searchSpace = searchSpace[1:]
+		if len(keys) == 0 {
+			log.Fatalf("No objects match %s", *search)
+		}
+
+		found = append(found, keys...)
+	}
 
-		for _, e := range currentNode.Edges {
-			if visited[e.End] {
+	if len(targets) == 0 && len(uids) == 0 && len(found) == 0 && !*interactive {
+		for n := range namesMap {
+			fmt.Fprintln(out, n)
+		}
+		return
+	}
+
+	index := checkpoint.IndexByUid(allObjects)
+	for _, uid := range uids {
+		key := checkpoint.ResolveRef(allObjects, index, "", uid)
+		if _, ok := allObjects[key]; !ok {
+			log.Fatalf("No object with uid %s", uid)
+		}
+		found = append(found, key)
+	}
+
+	//Uids are exact, so they win over any names given as well
+	if len(uids) != 0 {
+		targets = nil
+	}
+
+	var missing []string
+	ambiguous := false
+	for _, name := range targets {
+		keys := namesMap[name]
+		if len(keys) == 0 {
+			//Exact names always win, the prefix is only tried when nothing has the name
+			keys = prefixMatches(namesMap, name)
+			if len(keys) > 1 {
+				ambiguous = true
+				log.Printf("Target %s matches several objects, give more of the name or pick one with -uid:", name)
+				for _, key := range keys {
+					n := allObjects[key]
+					log.Printf("\t%s %s (%s) %s", n.Name, n.Uid, n.Type, strings.TrimSpace(n.IPv4+" "+n.IPv6))
+				}
 				continue
 			}
 
-			searchSpace = append(searchSpace, e.End)
-			visited[e.End] = true
+			if len(keys) == 1 {
+				log.Printf("Target %s matched %s", name, allObjects[keys[0]].Name)
+			}
+		}
 
+		switch len(keys) {
+		case 0:
+			missing = append(missing, name)
+		case 1:
+			found = append(found, keys[0])
+		default:
+			ambiguous = true
+			log.Printf("Target %s is ambiguous, pick one with -uid:", name)
+			for _, key := range keys {
+				n := allObjects[key]
+				log.Printf("\t%s (%s) %s", n.Uid, n.Type, strings.TrimSpace(n.IPv4+" "+n.IPv6))
+			}
 		}
 	}
 
-	return
-}
+	if ambiguous {
+		os.Exit(1)
+	}
+
+	if len(missing) != 0 {
+		log.Printf("Targets not found: %s", strings.Join(missing, ", "))
+	}
+
+	if len(found) == 0 && !*interactive {
+		log.Fatal("No targets found")
+	}
+
+	opts := auditOptions{
+		maxDepth:     *maxDepth,
+		childrenOnly: *childrenOnly,
+		checkRules:   !*assocOnly && !*childrenOnly,
+
+		includeDisabled: *includeDisabled,
+		explain:         *explain,
+		sortBy:          *sortBy,
+		modifiedSince:   modifiedSince,
+		wide:            *wide,
+		checkNAT:        *natPath != "",
+		strictNetwork:   *strictNetwork,
+		combined:        *combinedView,
+		belongsTypes:    belongsTypes,
+		columns:         columns,
+		noExpand:        *noExpand,
+		raw:             *rawRules,
+		tag:             *tag,
+		associations:    checkpoint.NewAssociationCache(),
+	}
+
+	var rules []checkpoint.ACLRule
+	if opts.checkRules {
+		rules = loadRules()
+
+		if *action != "" {
+			rules = withAction(rules, allObjects, *action)
+		}
+
+		if *layer != "" {
+			rules = withLayer(rules, allObjects, *layer)
+		}
+
+		if *zeroHits {
+			rules = withoutHits(rules)
+		}
+
+		if *serviceValue != "" {
+			f, err := parseServiceFilter(*serviceValue)
+			check(err)
 
-func getPermissionGroups(n *Node) (assoc []*Node) {
-	visited := make(map[*Node]bool)
+			rules = withService(rules, allObjects, f)
+		}
+	}
+
+	var natRules []checkpoint.NATRule
+	if opts.checkNAT {
+		natSets, err := loadNATSets(*natPath)
+		check(err)
+
+		natRules, err = checkpoint.ParseNATRules(natSets, allObjects, *domain)
+		check(err)
+	}
 
-	visited[n] = true
-	searchSpace := []*Node{n}
-	//Only add directly connected networks and hosts
-	for _, e := range n.Edges {
-		if !visited[e.End] && (e.End.Type == "network" || e.End.Type == "host") {
-			visited[e.End] = true
-			searchSpace = append(searchSpace, e.End)
+	if *interactive {
+		s := session{
+			allObjects: allObjects,
+			namesMap:   namesMap,
+			gateways:   gateways,
+			rules:      rules,
+			natRules:   natRules,
+			opts:       opts,
+			format:     *format,
+			quiet:      *quiet,
 		}
+		s.run(os.Stdin)
+		return
 	}
 
-	for len(searchSpace) != 0 {
-		currentNode := searchSpace[0]
-		assoc = append(assoc, currentNode)
-		searchSpace = searchSpace[1:]
+	var graphNodes []*checkpoint.Node
+	inGraph := make(map[*checkpoint.Node]bool)
 
-		for _, e := range currentNode.Edges {
-			if visited[e.Start] || currentNode.Type == "host" {
-				continue
+	exitCode := exitOK
+	var reports []*report
+	//One JSON document for the whole run, not one per target
+	jsonList := *format == "json" && len(found) > 1
+
+	audited, associated := auditAll(found, *jobs, func(key string) (*report, []*checkpoint.Node) {
+		return auditTarget(allObjects[key].Name, allObjects[key], allObjects, gateways, rules, natRules, opts)
+	})
+
+	for i, key := range found {
+		name := allObjects[key].Name
+		results, associatedNodes := audited[i], associated[i]
+
+		for _, n := range associatedNodes {
+			if !inGraph[n] {
+				inGraph[n] = true
+				graphNodes = append(graphNodes, n)
+			}
+		}
+
+		if textFormat(*format) && len(found) > 1 {
+			if i != 0 {
+				fmt.Fprint(out, "\n")
 			}
 
-			searchSpace = append(searchSpace, e.Start)
-			visited[e.Start] = true
+			if *format == "markdown" {
+				fmt.Fprintf(out, "## %s\n\n", name)
+			} else {
+				fmt.Fprintf(out, "===== %s =====\n\n", name)
+			}
+		}
 
+		if expected != nil {
+			results.Unexpected = unexpectedAccess(results.AccessFrom, expected)
+		}
+
+		results.quiet = *quiet
+		switch {
+		case jsonList:
+			//Printed together once every target is audited
+		case *countOnly:
+			results.printCounts(*format)
+		default:
+			results.output(*format)
+		}
+		reports = append(reports, results)
+
+		for _, row := range results.AccessFrom {
+			if *failIfAccess && row.accept && exitCode == exitOK {
+				exitCode = exitAccessFound
+			}
+		}
+
+		if len(results.Unexpected) != 0 {
+			exitCode = exitUnexpected
 		}
 	}
 
-	return
-}
+	if jsonList {
+		printJSONReports(reports, *countOnly)
+	}
+
+	if cidrKey != "" {
+		delete(allObjects, cidrKey)
+	}
+
+	if *dotPath != "" {
+		saveDot(*dotPath, graphNodes)
+	}
+
+	if *summaryPath != "" {
+		appendSummaries(*summaryPath, reports, time.Now())
+	}
 
-func doRuleApply(associatedObjects map[string]bool, allObjects map[string]*Node, acl ACLRule, uid string) bool {
-	return (associatedObjects[uid] || allObjects[uid].Type == "CpmiAnyObject")
+	if *htmlPath != "" {
+		saveHTML(*htmlPath, reports, allObjects)
+	}
+
+	os.Exit(exitCode)
 }
 
-func buildTable(table *table.Table, acl []ACLRule, allObjects map[string]*Node) {
+func buildRows(acl []checkpoint.ACLRule, allObjects map[string]*checkpoint.Node) []ruleRow {
+	rows := []ruleRow{}
 	for _, aclr := range acl {
 
-		src := ""
+		//Rules that only define a service can have empty sides, these become empty cells
+		row := ruleRow{
+			Firewall:    aclr.Firewall,
+			Number:      aclr.Number,
+			Name:        aclr.Name,
+			Disabled:    !aclr.Enabled,
+			Source:      []string{},
+			Destination: []string{},
+			Service:     []string{},
+			Time:        []string{},
+			Layer:       layerName(aclr, allObjects),
+			InstallOn:   []string{},
+			Action:      checkpoint.Lookup(allObjects, aclr.Action).Name,
+			accept:      isAccept(checkpoint.Lookup(allObjects, aclr.Action)),
+		}
+
+		if aclr.Hits != nil {
+			hits := aclr.Hits.Value
+			row.Hits = &hits
+		}
+
 		for _, v := range aclr.Source {
+			src := sideName(checkpoint.Lookup(allObjects, v))
 			if aclr.SrcNegate {
-				src += "!"
+				src = "!" + src
 			}
 
-			src += allObjects[v].Name + "\n"
-
+			row.Source = append(row.Source, src)
 		}
-		src = src[:len(src)-1]
 
-		dst := ""
 		for _, v := range aclr.Destination {
+			dst := sideName(checkpoint.Lookup(allObjects, v))
 			if aclr.DstNegate {
-				dst += "!"
+				dst = "!" + dst
 			}
 
-			dst += allObjects[v].Name + "\n"
-
+			row.Destination = append(row.Destination, dst)
 		}
-		dst = dst[:len(dst)-1]
 
-		service := ""
 		for _, v := range aclr.Service {
-			serv := allObjects[v]
-
-			if strings.Contains(serv.Type, "service-group") {
-				service += recurseServiceGroup(serv, serv.Name, allObjects)
-				continue
+			serv := checkpoint.Lookup(allObjects, v)
+
+			var services []serviceCell
+			switch {
+			case serv.Type == checkpoint.MissingType:
+				services = []serviceCell{{Name: serv.Name}}
+			case strings.Contains(serv.Type, "service-group"):
+				services = recurseServiceGroup(serv, serv.Name, allObjects, make(map[string]bool))
+			case checkpoint.IsAnyObject(serv):
+				//Stands out from service names, every service is allowed
+				services = []serviceCell{{Name: "ANY"}}
+			case serv.Type == "dns-domain":
+				services = []serviceCell{{Name: sideName(serv)}}
+			default:
+				services = []serviceCell{describeService(serv)}
 			}
 
-			service += serv.Name + ":" + serv.Type
-			if !strings.Contains(serv.Type, "icmp") {
-				service += ":" + serv.Port
+			for _, s := range services {
+				if aclr.ServiceNegate {
+					s.Name = "!" + s.Name
+				}
+
+				row.Service = append(row.Service, s.String())
+				row.services = append(row.services, s)
 			}
+		}
 
-			if serv.Type == "CpmiAnyObject" {
-				service = "Any"
+		for _, v := range aclr.InstallOn {
+			row.InstallOn = append(row.InstallOn, checkpoint.Lookup(allObjects, v).Name)
+		}
+
+		for _, v := range aclr.Time {
+			if t := checkpoint.Lookup(allObjects, v); !checkpoint.IsAnyObject(t) {
+				row.Time = append(row.Time, describeTime(t))
 			}
+		}
+
+		if len(row.Time) == 0 {
+			row.Time = append(row.Time, "always")
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
 
-			service += "\n"
+// DNS domains are matched on name resolution, mark them so they aren't read as address objects
+func sideName(n *checkpoint.Node) string {
+	switch n.Type {
+	case "dns-domain":
+		return n.Name + " (dns)"
+	case checkpoint.UpdatableObjectType:
+		return n.Name + " (updatable)"
+	case checkpoint.DynamicObjectType:
+		return n.Name + " (dynamic)"
+	}
 
+	return n.Name
+}
+
+func buildNATRows(rules []checkpoint.NATRule, allObjects map[string]*checkpoint.Node) []natRow {
+	name := func(ref checkpoint.Reference) string {
+		if ref == "" {
+			return ""
 		}
+		return checkpoint.Lookup(allObjects, string(ref)).Name
+	}
 
-		err := table.AddValues(aclr.Firewall, fmt.Sprintf("%d", aclr.Number), src, dst, service, allObjects[aclr.Action].Name)
-		check(err)
+	rows := []natRow{}
+	for _, nat := range rules {
+		rows = append(rows, natRow{
+			Firewall:              nat.Firewall,
+			Number:                nat.Number,
+			Name:                  nat.Name,
+			Method:                nat.Method,
+			OriginalSource:        name(nat.OriginalSource),
+			OriginalDestination:   name(nat.OriginalDestination),
+			OriginalService:       name(nat.OriginalService),
+			TranslatedSource:      name(nat.TranslatedSource),
+			TranslatedDestination: name(nat.TranslatedDestination),
+			TranslatedService:     name(nat.TranslatedService),
+			Disabled:              !nat.Enabled,
+		})
+	}
+
+	return rows
+}
+
+func describeService(serv *checkpoint.Node) serviceCell {
+	//Layer 7 applications aren't matched by port
+	if isApplication(serv) {
+		return serviceCell{Name: serv.Name, Protocol: "application"}
+	}
 
+	if strings.Contains(serv.Type, "icmp") {
+		c := serviceCell{Name: serv.Name, Protocol: "icmp"}
+		if serv.IcmpType != nil {
+			c.Port = strconv.Itoa(*serv.IcmpType)
+			if serv.IcmpCode != nil {
+				c.Port += "/" + strconv.Itoa(*serv.IcmpCode)
+			}
+		}
+
+		return c
 	}
 
+	return serviceCell{Name: serv.Name, Protocol: serv.Type, Port: serv.PortString()}
 }
 
-func recurseServiceGroup(service *Node, groupName string, allObjects map[string]*Node) string {
-	services := ""
+// Each group is only expanded once per service, so cyclic membership terminates
+func recurseServiceGroup(service *checkpoint.Node, groupName string, allObjects map[string]*checkpoint.Node, expanded map[string]bool) (services []serviceCell) {
+	if expanded[service.Key()] {
+		return nil
+	}
+	expanded[service.Key()] = true
+
 	for _, member := range service.Members {
-		subservice := allObjects[member]
+		subservice := checkpoint.Lookup(allObjects, member)
+		if subservice.Type == checkpoint.MissingType {
+			services = append(services, serviceCell{Name: groupName + ":" + subservice.Name})
+			continue
+		}
+
 		if subservice.Type == "service-group" {
 
-			services += recurseServiceGroup(subservice, subservice.Name, allObjects)
+			services = append(services, recurseServiceGroup(subservice, subservice.Name, allObjects, expanded)...)
+
+			continue
+		}
 
+		if checkpoint.IsAnyObject(subservice) {
+			services = append(services, serviceCell{Name: groupName + ":ANY"})
 			continue
 		}
 
-		services += groupName + ":" + subservice.Name + ":" + subservice.Type
-		if !strings.Contains(subservice.Type, "icmp") {
-			services += ":" + subservice.Port
+		if !isService(subservice) {
+			services = append(services, serviceCell{Name: groupName + ":" + subservice.Name + " (⚠ non-service member " + subservice.Type + ")"})
+			continue
 		}
-		services += "\n"
+
+		c := describeService(subservice)
+		c.Name = groupName + ":" + c.Name
+		services = append(services, c)
 	}
 
 	return services
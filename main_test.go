@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+func TestEmptySidesRender(t *testing.T) {
+	objects := testObjects(t, testExport)
+
+	serviceOnly := checkpoint.ACLRule{Firewall: "fw1", Number: 1, Action: "acc", Destination: []string{}, Service: []string{"s1"}}
+
+	rows := buildRows([]checkpoint.ACLRule{serviceOnly}, objects)
+	if len(rows[0].Source) != 0 || len(rows[0].Destination) != 0 {
+		t.Fatalf("Expected no sources or destinations, got %v and %v", rows[0].Source, rows[0].Destination)
+	}
+
+	//Empty cells, not nulls, in the JSON output
+	b, err := json.Marshal(rows[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var row map[string]interface{}
+	if err := json.Unmarshal(b, &row); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, side := range []string{"source", "destination"} {
+		if cells, ok := row[side].([]interface{}); !ok || len(cells) != 0 {
+			t.Errorf("Expected %s to be an empty array, got %v", side, row[side])
+		}
+	}
+}
+
+func TestAcceptUids(t *testing.T) {
+	objects := testObjects(t, `[
+		{"uid": "acc", "name": "Accept", "type": "RulebaseAction"},
+		{"uid": "local", "name": "Allow-Local", "type": "RulebaseAction"},
+		{"uid": "drop", "name": "Drop", "type": "RulebaseAction"}
+	]`)
+
+	defer func() { acceptUids = make(map[string]bool) }()
+	acceptUids = map[string]bool{"local": true, "nope": true}
+
+	tests := []struct {
+		action string
+		accept bool
+	}{
+		{action: "acc", accept: true},
+		{action: "local", accept: true},
+		{action: "drop", accept: false},
+		//Unresolved actions don't match by their <missing:...> name
+		{action: "missing", accept: false},
+	}
+
+	for _, test := range tests {
+		if got := isAccept(checkpoint.Lookup(objects, test.action)); got != test.accept {
+			t.Errorf("Action %s: expected accept %v, got %v", test.action, test.accept, got)
+		}
+	}
+
+	if isAcceptName("<missing:nope>") {
+		t.Error("An unknown accept uid shouldn't make its missing placeholder an accept name")
+	}
+}
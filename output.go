@@ -0,0 +1,881 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+	"github.com/NHAS/checkpoint-audit/table"
+)
+
+type gatewayRow struct {
+	Name  string `json:"name"`
+	Range string `json:"matching_range"`
+	UID   string `json:"uid"`
+}
+
+type membershipRow struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Extra   string `json:"extra"`
+	Comment string `json:"comment"`
+	UID     string `json:"uid"`
+	Domain  string `json:"domain,omitempty"`
+	//Only set with -modified-since, for objects changed after it
+	Modified string `json:"modified,omitempty"`
+}
+
+type ruleRow struct {
+	Firewall    string   `json:"firewall"`
+	Layer       string   `json:"layer"`
+	InstallOn   []string `json:"install_on"`
+	Number      int      `json:"number"`
+	Name        string   `json:"name"`
+	Source      []string `json:"source"`
+	Destination []string `json:"destination"`
+	Service     []string `json:"service"`
+	Time        []string `json:"time"`
+	Action      string   `json:"action"`
+	Disabled    bool     `json:"disabled"`
+	Explain     []string `json:"explain,omitempty"`
+	Hits        *int     `json:"hits,omitempty"`
+	//Only with -combined, which side of the rule the target is on
+	Dir string `json:"dir,omitempty"`
+	//Only with -raw
+	Raw json.RawMessage `json:"raw,omitempty"`
+
+	services []serviceCell
+	//Decided by the action object, the uid can count as well as the name
+	accept bool
+}
+
+// Parts of a service, Service strings are these joined up
+type serviceCell struct {
+	Name     string
+	Protocol string
+	Port     string
+}
+
+func (c serviceCell) String() string {
+	switch {
+	case c.Protocol == "":
+		return c.Name
+	case c.Port == "":
+		//e.g service-other and application services, which don't have a port
+		return c.Name + ":" + c.Protocol
+	}
+
+	return c.Name + ":" + c.Protocol + ":" + c.Port
+}
+
+type protocolRow struct {
+	Protocol string `json:"protocol"`
+	Rules    int    `json:"rules"`
+}
+
+// Protocol of a service cell, negated services allow everything else so they count as Any
+func serviceClass(c serviceCell) string {
+	switch protocol := strings.ToLower(c.Protocol); {
+	case strings.HasPrefix(c.Name, "!") || c.Name == "ANY" || strings.HasSuffix(c.Name, ":ANY"):
+		return "Any"
+	case strings.Contains(protocol, "tcp"):
+		return "TCP"
+	case strings.Contains(protocol, "udp"):
+		return "UDP"
+	case strings.Contains(protocol, "icmp"):
+		return "ICMP"
+	}
+
+	return "Other"
+}
+
+// How many accept rules allow each protocol, a rule with several services counts once for each protocol. Nil when no rule accepts
+func protocolCounts(rows []ruleRow) []protocolRow {
+	counts := make(map[string]int)
+	accepting := 0
+	for _, row := range rows {
+		if !row.accept {
+			continue
+		}
+		accepting++
+
+		seen := make(map[string]bool)
+		for _, c := range row.services {
+			if class := serviceClass(c); !seen[class] {
+				seen[class] = true
+				counts[class]++
+			}
+		}
+	}
+
+	if accepting == 0 {
+		return nil
+	}
+
+	var protocols []protocolRow
+	for _, class := range []string{"TCP", "UDP", "ICMP", "Any", "Other"} {
+		if class == "Other" && counts[class] == 0 {
+			continue
+		}
+		protocols = append(protocols, protocolRow{Protocol: class, Rules: counts[class]})
+	}
+
+	return protocols
+}
+
+func (row ruleRow) label() string {
+	if row.Name == "" {
+		return fmt.Sprintf("%d", row.Number)
+	}
+
+	return fmt.Sprintf("%d: %s", row.Number, row.Name)
+}
+
+func hitCount(row ruleRow) int {
+	if row.Hits == nil {
+		return -1
+	}
+
+	return *row.Hits
+}
+
+func validSort(by string) bool {
+	switch by {
+	case "", "number", "src", "dst", "service", "hits":
+		return true
+	}
+	return false
+}
+
+func sortRows(rows []ruleRow, by string) {
+	key := func(row ruleRow) string {
+		switch by {
+		case "src":
+			return strings.Join(row.Source, "\n")
+		case "dst":
+			return strings.Join(row.Destination, "\n")
+		case "service":
+			return strings.Join(row.Service, "\n")
+		}
+		return ""
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if by == "number" {
+			return rows[i].Number < rows[j].Number
+		}
+		//Busiest first, rules without counts last
+		if by == "hits" {
+			return hitCount(rows[i]) > hitCount(rows[j])
+		}
+		return key(rows[i]) < key(rows[j])
+	})
+}
+
+type natRow struct {
+	Firewall              string `json:"firewall"`
+	Number                int    `json:"number"`
+	Name                  string `json:"name"`
+	Method                string `json:"method"`
+	OriginalSource        string `json:"original_source"`
+	OriginalDestination   string `json:"original_destination"`
+	OriginalService       string `json:"original_service"`
+	TranslatedSource      string `json:"translated_source"`
+	TranslatedDestination string `json:"translated_destination"`
+	TranslatedService     string `json:"translated_service"`
+	Disabled              bool   `json:"disabled"`
+}
+
+type ruleSummary struct {
+	Enabled  int `json:"enabled"`
+	Disabled int `json:"disabled"`
+}
+
+type report struct {
+	Target     string          `json:"target"`
+	Gateways   []gatewayRow    `json:"egress_gateways"`
+	BelongsTo  []membershipRow `json:"belongs_to"`
+	AccessTo   []ruleRow       `json:"access_to"`
+	AccessFrom []ruleRow       `json:"access_from"`
+	Intra      []ruleRow       `json:"intra_target"`
+	Summary    ruleSummary     `json:"rule_summary"`
+	NAT        []natRow        `json:"nat,omitempty"`
+	//Accept rules letting anything reach the target, or the target reach anything
+	Rules               []ruleRow `json:"rules,omitempty"`
+	AnySourceRules      []ruleRow `json:"any_source_rules,omitempty"`
+	AnyDestinationRules []ruleRow `json:"any_destination_rules,omitempty"`
+	//Only with -expected, accept rules to the target that aren't expected
+	Unexpected []ruleRow `json:"unexpected_access,omitempty"`
+	//Accept rules to the target by the protocols they allow
+	Protocols []protocolRow `json:"protocols,omitempty"`
+
+	hasGateways  bool
+	hasNAT       bool
+	rulesChecked bool
+	showDisabled bool
+	showExplain  bool
+	showModified bool
+	showHits     bool
+	combined     bool
+	wide         bool
+	//Belongs to columns picked with -columns, all when empty
+	columns []string
+	quiet   bool
+
+	//A matched rule had Any on that side
+	anySource      bool
+	anyDestination bool
+}
+
+type runSummary struct {
+	Target         string    `json:"target"`
+	Time           time.Time `json:"time"`
+	BelongsTo      int       `json:"belongs_to"`
+	AccessTo       int       `json:"access_to"`
+	AccessFrom     int       `json:"access_from"`
+	AnySource      bool      `json:"any_source"`
+	AnyDestination bool      `json:"any_destination"`
+}
+
+// One line per target so the file can be appended to on every run and trended
+func appendSummaries(path string, reports []*report, now time.Time) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	check(err)
+	defer f.Close()
+
+	for _, r := range reports {
+		b, err := json.Marshal(runSummary{
+			Target:         r.Target,
+			Time:           now,
+			BelongsTo:      len(r.BelongsTo),
+			AccessTo:       len(r.AccessTo),
+			AccessFrom:     len(r.AccessFrom),
+			AnySource:      r.anySource,
+			AnyDestination: r.anyDestination,
+		})
+		check(err)
+
+		_, err = fmt.Fprintln(f, string(b))
+		check(err)
+	}
+}
+
+type targetCounts struct {
+	Target     string `json:"target"`
+	BelongsTo  int    `json:"belongs_to"`
+	AccessTo   int    `json:"access_to"`
+	AccessFrom int    `json:"access_from"`
+}
+
+func (r *report) counts() targetCounts {
+	return targetCounts{Target: r.Target, BelongsTo: len(r.BelongsTo), AccessTo: len(r.AccessTo), AccessFrom: len(r.AccessFrom)}
+}
+
+// Just the numbers of a report, for -count-only
+func (r *report) printCounts(format string) {
+	counts := r.counts()
+
+	if format == "json" {
+		b, err := marshalJSON(counts)
+		check(err)
+
+		fmt.Fprintln(out, string(b))
+		return
+	}
+
+	fmt.Fprintf(out, "belongs_to: %d\naccess_to: %d\naccess_from: %d\n", counts.BelongsTo, counts.AccessTo, counts.AccessFrom)
+}
+
+func newReport(target string) *report {
+	return &report{
+		Target:     target,
+		Gateways:   []gatewayRow{},
+		BelongsTo:  []membershipRow{},
+		AccessTo:   []ruleRow{},
+		AccessFrom: []ruleRow{},
+		Intra:      []ruleRow{},
+	}
+}
+
+type section struct {
+	Key     string
+	Title   string
+	Headers []string
+	//Printed with a blank line before it in table mode
+	Spaced bool
+	//Each cell can hold several values, formats decide how to join them
+	Rows [][][]string
+	//Object key of each row, for sections that list objects
+	Keys []string
+	//Totals under the rows, tables only
+	Footer []string
+	//Whether each row's action lets traffic through, for sections that list rules
+	Accepts []bool
+}
+
+var belongsColumns = []string{"Name", "Type", "Extra", "Comment", "UID", "Modified"}
+
+// Only the named columns, in the order given. Names are case insensitive and ones the section doesn't have are left out
+func (s section) project(columns []string) section {
+	var indexes []int
+	for _, c := range columns {
+		for i, h := range s.Headers {
+			if strings.EqualFold(c, h) {
+				indexes = append(indexes, i)
+				break
+			}
+		}
+	}
+
+	projected := s
+	projected.Headers, projected.Rows = nil, nil
+	for _, i := range indexes {
+		projected.Headers = append(projected.Headers, s.Headers[i])
+	}
+
+	for _, row := range s.Rows {
+		var cells [][]string
+		for _, i := range indexes {
+			cells = append(cells, row[i])
+		}
+		projected.Rows = append(projected.Rows, cells)
+	}
+
+	return projected
+}
+
+func cell(values ...string) []string {
+	return values
+}
+
+func validFormat(format string) bool {
+	switch format {
+	case "table", "json", "csv", "tsv", "markdown":
+		return true
+	}
+	return false
+}
+
+// Formats read by people, these get the notes and summaries around the tables
+func textFormat(format string) bool {
+	return format == "table" || format == "markdown"
+}
+
+func (r *report) output(format string) {
+	switch format {
+	case "json":
+		r.printJSON()
+		return
+	case "csv":
+		printCSV(out, r.visibleSections())
+		return
+	case "tsv":
+		printTSV(out, r.visibleSections())
+		return
+	case "markdown":
+		printMarkdown(out, r.visibleSections())
+	default:
+		printTables(r.visibleSections())
+	}
+
+	r.printRaw(format)
+
+	if r.rulesChecked {
+		if r.quiet && len(r.AccessTo) == 0 && len(r.AccessFrom) == 0 {
+			fmt.Fprintf(out, "\nno access rules matched %s\n", r.Target)
+			return
+		}
+
+		fmt.Fprintf(out, "\n%d enabled and %d disabled rules referenced %s\n", r.Summary.Enabled, r.Summary.Disabled, r.Target)
+	}
+}
+
+// Export JSON of every matched rule once, in table order, for -raw
+func (r *report) printRaw(format string) {
+	seen := make(map[string]bool)
+	for _, rows := range [][]ruleRow{r.AccessTo, r.AccessFrom, r.Intra} {
+		for _, row := range rows {
+			key := fmt.Sprintf("%s/%s/%d", row.Firewall, row.Layer, row.Number)
+			if row.Raw == nil || seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			var indented bytes.Buffer
+			check(json.Indent(&indented, row.Raw, "", "\t"))
+
+			if format == "markdown" {
+				fmt.Fprintf(out, "\nRule %s on %s\n\n```json\n%s\n```\n", row.label(), row.Firewall, indented.String())
+				continue
+			}
+
+			fmt.Fprintf(out, "\nRule %s on %s\n%s\n", row.label(), row.Firewall, indented.String())
+		}
+	}
+}
+
+// Quiet reports drop empty tables, and the belongs to table when it only holds the target
+func (r *report) visibleSections() []section {
+	sections := r.sections()
+	if !r.quiet {
+		return sections
+	}
+
+	var visible []section
+	for _, s := range sections {
+		if len(s.Rows) == 0 || (s.Key == "belongs_to" && len(s.Rows) == 1) {
+			continue
+		}
+		visible = append(visible, s)
+	}
+
+	return visible
+}
+
+func (r *report) printJSON() {
+	b, err := marshalJSON(topJSON(r))
+	check(err)
+
+	fmt.Fprintln(out, string(b))
+}
+
+// Several targets are a single JSON array, one report (or its counts with countOnly) per target in audit order
+func printJSONReports(reports []*report, countOnly bool) {
+	docs := []interface{}{}
+	for _, r := range reports {
+		if countOnly {
+			docs = append(docs, r.counts())
+			continue
+		}
+		docs = append(docs, topJSON(r))
+	}
+
+	b, err := marshalJSON(docs)
+	check(err)
+
+	fmt.Fprintln(out, string(b))
+}
+
+func (r *report) ruleSection(key, title string, rows []ruleRow) section {
+	s := section{Key: key, Title: title, Spaced: true, Headers: []string{"Firewall", "Layer", "No."}}
+	if r.combined {
+		s.Headers = append(s.Headers, "Dir")
+	}
+	s.Headers = append(s.Headers, "Src", "Dst", "Service")
+	if r.wide {
+		s.Headers = append(s.Headers, "Protocol", "Port")
+	}
+	s.Headers = append(s.Headers, "Action", "Time")
+	if r.showDisabled {
+		s.Headers = append(s.Headers, "State")
+	}
+	if r.showExplain {
+		s.Headers = append(s.Headers, "Matched Via")
+	}
+	if r.showHits {
+		s.Headers = append(s.Headers, "Hits")
+	}
+
+	for _, row := range rows {
+		cells := [][]string{cell(row.Firewall), cell(row.Layer), cell(row.label())}
+		if r.combined {
+			cells = append(cells, cell(row.Dir))
+		}
+		cells = append(cells, row.Source, row.Destination)
+		if r.wide {
+			//One line per service in each column, so the parts line up
+			names, protocols, ports := []string{}, []string{}, []string{}
+			for _, c := range row.services {
+				names, protocols, ports = append(names, c.Name), append(protocols, c.Protocol), append(ports, c.Port)
+			}
+
+			cells = append(cells, names, protocols, ports)
+		} else {
+			cells = append(cells, row.Service)
+		}
+		cells = append(cells, cell(row.Action), row.Time)
+		if r.showDisabled {
+			state := ""
+			if row.Disabled {
+				state = "(disabled)"
+			}
+			cells = append(cells, cell(state))
+		}
+		if r.showExplain {
+			cells = append(cells, row.Explain)
+		}
+		if r.showHits {
+			hits := ""
+			if row.Hits != nil {
+				hits = strconv.Itoa(*row.Hits)
+			}
+			cells = append(cells, cell(hits))
+		}
+
+		s.Rows = append(s.Rows, cells)
+		s.Accepts = append(s.Accepts, row.accept)
+	}
+
+	if len(rows) != 0 {
+		s.Footer = ruleTotals(s.Headers, rows)
+	}
+
+	return s
+}
+
+// Footer of a rule table, the rule count and how many distinct sources and services the rules use
+func ruleTotals(headers []string, rows []ruleRow) []string {
+	sources, services := make(map[string]bool), make(map[string]bool)
+	for _, row := range rows {
+		for _, src := range row.Source {
+			sources[src] = true
+		}
+		for _, serv := range row.Service {
+			services[serv] = true
+		}
+	}
+
+	footer := make([]string, len(headers))
+	for i, h := range headers {
+		switch h {
+		case "Firewall":
+			footer[i] = "Total"
+		case "No.":
+			footer[i] = fmt.Sprintf("%d rules", len(rows))
+		case "Src":
+			footer[i] = fmt.Sprintf("%d sources", len(sources))
+		case "Service":
+			footer[i] = fmt.Sprintf("%d services", len(services))
+		}
+	}
+
+	return footer
+}
+
+func (r *report) sections() (sections []section) {
+	if r.hasGateways {
+		s := section{Key: "egress_gateways", Title: "Egress Gateways", Headers: []string{"Name", "Matching Range", "UID"}}
+		for _, g := range r.Gateways {
+			s.Rows = append(s.Rows, [][]string{cell(g.Name), cell(g.Range), cell(g.UID)})
+		}
+		sections = append(sections, s)
+	}
+
+	s := section{Key: "belongs_to", Title: r.Target + " Belongs To", Headers: []string{"Name", "Type", "Extra", "Comment", "UID"}}
+	if r.showModified {
+		s.Headers = append(s.Headers, "Modified")
+	}
+	for _, m := range r.BelongsTo {
+		cells := [][]string{cell(m.Name), cell(m.Type), cell(m.Extra), cell(m.Comment), cell(m.UID)}
+		if r.showModified {
+			cells = append(cells, cell(m.Modified))
+		}
+		s.Rows = append(s.Rows, cells)
+		s.Keys = append(s.Keys, checkpoint.ObjectKey(checkpoint.DomainName(m.Domain), m.UID))
+	}
+	if len(r.columns) != 0 {
+		s = s.project(r.columns)
+	}
+	sections = append(sections, s)
+
+	if r.hasNAT {
+		s := section{Key: "nat", Title: "NAT rules translating " + r.Target, Spaced: true, Headers: []string{"Firewall", "No.", "Method", "Orig Src", "Orig Dst", "Orig Service", "Trans Src", "Trans Dst", "Trans Service"}}
+		for _, n := range r.NAT {
+			label := ruleRow{Number: n.Number, Name: n.Name}.label()
+			if n.Disabled {
+				label += " (disabled)"
+			}
+
+			s.Rows = append(s.Rows, [][]string{cell(n.Firewall), cell(label), cell(n.Method),
+				cell(n.OriginalSource), cell(n.OriginalDestination), cell(n.OriginalService),
+				cell(n.TranslatedSource), cell(n.TranslatedDestination), cell(n.TranslatedService)})
+		}
+		sections = append(sections, s)
+	}
+
+	if r.rulesChecked && r.combined {
+		sections = append(sections, r.ruleSection("rules", "Rules referencing "+r.Target, r.Rules))
+	} else if r.rulesChecked {
+		sections = append(sections,
+			r.ruleSection("access_to", r.Target+"->Target", r.AccessTo),
+			r.ruleSection("access_from", "Target->"+r.Target, r.AccessFrom),
+			r.ruleSection("intra_target", "Intra-target "+r.Target, r.Intra),
+		)
+	}
+
+	if r.rulesChecked {
+		//Only shown when there are some, so they stand out
+		if len(r.AnySourceRules) != 0 {
+			sections = append(sections, r.ruleSection("any_source", "Any->"+r.Target+" (accepts from anything)", r.AnySourceRules))
+		}
+		if len(r.AnyDestinationRules) != 0 {
+			sections = append(sections, r.ruleSection("any_destination", r.Target+"->Any (accepts to anything)", r.AnyDestinationRules))
+		}
+
+		if len(r.Unexpected) != 0 {
+			sections = append(sections, r.ruleSection("unexpected_access", "Unexpected access to "+r.Target, r.Unexpected))
+		}
+
+		if len(r.Protocols) != 0 {
+			s := section{Key: "protocols", Title: "Protocols accepted to " + r.Target, Spaced: true, Headers: []string{"Protocol", "Rules"}}
+			for _, p := range r.Protocols {
+				s.Rows = append(s.Rows, [][]string{cell(p.Protocol), cell(fmt.Sprintf("%d", p.Rules))})
+			}
+			sections = append(sections, s)
+		}
+	}
+
+	return
+}
+
+func joinCells(row [][]string, sep string) (values []string) {
+	for _, c := range row {
+		values = append(values, strings.Join(c, sep))
+	}
+	return
+}
+
+// Where reports are written, -o points it at a file so warnings and progress on stderr stay separate
+var out io.Writer = os.Stdout
+
+// Widest a table cell line can be before it is truncated, 0 for no limit. JSON and CSV always have the full values
+var maxCellWidth int
+
+var colorMode = table.ColorAuto
+
+// Rules are colored by their action, drops and rejects red and accept actions green
+func actionColor(s section) func(values []string) string {
+	column := -1
+	for i, h := range s.Headers {
+		if h == "Action" {
+			column = i
+		}
+	}
+
+	if column < 0 {
+		return nil
+	}
+
+	//Rows are colored in the order they are added, so this counts which one is being colored
+	row := 0
+	return func(values []string) string {
+		accept := isAcceptName(values[column])
+		if s.Accepts != nil {
+			accept = s.Accepts[row]
+		}
+		row++
+
+		if accept {
+			return table.Green
+		}
+
+		switch strings.ToLower(values[column]) {
+		case "drop", "reject":
+			return table.Red
+		}
+
+		return ""
+	}
+}
+
+// Rows shown per table with -top, 0 for all of them
+var topRows int
+
+func shownRows(n int) int {
+	if topRows > 0 && n > topRows {
+		return topRows
+	}
+
+	return n
+}
+
+// Cuts a slice, or every slice field of a struct, to the -top rows. Summaries and counts are left whole
+func topJSON(v interface{}) interface{} {
+	if topRows <= 0 {
+		return v
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice:
+		return rv.Slice(0, shownRows(rv.Len())).Interface()
+	case reflect.Struct:
+		cut := reflect.New(rv.Type()).Elem()
+		cut.Set(rv)
+		for i := 0; i < cut.NumField(); i++ {
+			if f := cut.Field(i); f.Kind() == reflect.Slice && f.CanSet() {
+				f.Set(f.Slice(0, shownRows(f.Len())))
+			}
+		}
+
+		return cut.Interface()
+	}
+
+	return v
+}
+
+// Indented JSON output with -json-pretty, otherwise a single line for piping
+var prettyJSON bool
+
+func marshalJSON(v interface{}) ([]byte, error) {
+	if prettyJSON {
+		return json.MarshalIndent(v, "", "  ")
+	}
+
+	return json.Marshal(v)
+}
+
+func printTables(sections []section) {
+	fprintTables(out, sections)
+}
+
+func fprintTables(w io.Writer, sections []section) {
+	for _, s := range sections {
+		if s.Spaced {
+			fmt.Fprint(w, "\n")
+		}
+
+		t, err := table.NewTable(s.Title, s.Headers...)
+		check(err)
+
+		t.SetMaxWidth(maxCellWidth)
+		t.SetColor(colorMode, actionColor(s))
+		shown := shownRows(len(s.Rows))
+		for _, row := range s.Rows[:shown] {
+			check(t.AddValues(joinCells(row, "\n")...))
+		}
+
+		if s.Footer != nil {
+			check(t.SetFooter(s.Footer...))
+		}
+
+		t.Print(w)
+
+		if more := len(s.Rows) - shown; more > 0 {
+			fmt.Fprintf(w, "... and %d more\n", more)
+		}
+	}
+}
+
+// GitHub flavoured tables, multi-line cells use <br> so each row stays on one line
+func printMarkdown(w io.Writer, sections []section) {
+	escape := strings.NewReplacer("|", "\\|", "\n", "<br>")
+	line := func(values []string) {
+		fmt.Fprintln(w, "| "+strings.Join(values, " | ")+" |")
+	}
+
+	for i, s := range sections {
+		if i != 0 || s.Spaced {
+			fmt.Fprint(w, "\n")
+		}
+
+		fmt.Fprintf(w, "### %s\n\n", s.Title)
+		line(s.Headers)
+
+		separator := make([]string, len(s.Headers))
+		for h := range separator {
+			separator[h] = "---"
+		}
+		line(separator)
+
+		shown := shownRows(len(s.Rows))
+		for _, row := range s.Rows[:shown] {
+			values := joinCells(row, "\n")
+			for v := range values {
+				values[v] = escape.Replace(values[v])
+			}
+			line(values)
+		}
+
+		if more := len(s.Rows) - shown; more > 0 {
+			fmt.Fprintf(w, "\n... and %d more\n", more)
+		}
+	}
+}
+
+// Sections follow each other in one stream, every record starts with the section it belongs to
+func printCSV(w io.Writer, sections []section) {
+	c := csv.NewWriter(w)
+
+	for _, s := range sections {
+		check(c.Write(append([]string{"Section"}, s.Headers...)))
+
+		for _, row := range s.Rows[:shownRows(len(s.Rows))] {
+			check(c.Write(append([]string{s.Key}, joinCells(row, ";")...)))
+		}
+	}
+
+	c.Flush()
+	check(c.Error())
+}
+
+// Like CSV without the quoting, for cut and awk. Tabs and newlines in values become spaces so every record stays one line.
+// There is a single header, with every section's columns in the order they first appear, rows leave the columns of other sections empty
+func printTSV(w io.Writer, sections []section) {
+	if len(sections) == 0 {
+		return
+	}
+
+	clean := strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+	line := func(values []string) {
+		for i := range values {
+			values[i] = clean.Replace(values[i])
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+
+	columns := []string{"Section"}
+	column := make(map[string]int)
+	for _, s := range sections {
+		for _, h := range s.Headers {
+			if _, ok := column[h]; !ok {
+				column[h] = len(columns)
+				columns = append(columns, h)
+			}
+		}
+	}
+	line(columns)
+
+	for _, s := range sections {
+		for _, row := range s.Rows[:shownRows(len(s.Rows))] {
+			values := make([]string, len(columns))
+			values[0] = s.Key
+			for i, v := range joinCells(row, ";") {
+				values[column[s.Headers[i]]] = v
+			}
+			line(values)
+		}
+	}
+}
+
+// Standalone reports are a single section, json output uses their rows directly
+func printSection(format string, s section, rows interface{}) {
+	switch format {
+	case "json":
+		b, err := marshalJSON(topJSON(rows))
+		check(err)
+
+		fmt.Fprintln(out, string(b))
+	case "csv":
+		printCSV(out, []section{s})
+	case "tsv":
+		printTSV(out, []section{s})
+	case "markdown":
+		printMarkdown(out, []section{s})
+	default:
+		printTables([]section{s})
+	}
+}
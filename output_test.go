@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestJSONSeveralTargets(t *testing.T) {
+	defer func(w io.Writer) { out = w }(out)
+
+	web1, db1 := newReport("web1"), newReport("db1")
+	web1.BelongsTo = []membershipRow{{Name: "web1"}, {Name: "net-web"}}
+
+	tests := []struct {
+		countOnly bool
+		belongsTo string
+	}{
+		{countOnly: false, belongsTo: `[{"name":"web1","type":"","extra":"","comment":"","uid":""},{"name":"net-web","type":"","extra":"","comment":"","uid":""}]`},
+		{countOnly: true, belongsTo: "2"},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		out = &b
+
+		printJSONReports([]*report{web1, db1}, test.countOnly)
+
+		var docs []struct {
+			Target    string          `json:"target"`
+			BelongsTo json.RawMessage `json:"belongs_to"`
+		}
+		if err := json.Unmarshal(b.Bytes(), &docs); err != nil {
+			t.Fatalf("Expected a single JSON array (count only %v), got %q: %s", test.countOnly, b.String(), err)
+		}
+
+		if len(docs) != 2 || docs[0].Target != "web1" || docs[1].Target != "db1" {
+			t.Fatalf("Expected web1 then db1 (count only %v), got %+v", test.countOnly, docs)
+		}
+
+		if got := string(docs[0].BelongsTo); got != test.belongsTo {
+			t.Errorf("Expected web1 to belong to %s (count only %v), got %s", test.belongsTo, test.countOnly, got)
+		}
+	}
+}
+
+func TestTSVSingleHeader(t *testing.T) {
+	sections := []section{
+		{Key: "belongs_to", Headers: []string{"Name", "Type"}, Rows: [][][]string{{{"web1"}, {"host"}}}},
+		{Key: "access_to", Headers: []string{"No.", "Name", "Service"}, Rows: [][][]string{{{"1"}, {"web out"}, {"https", "dns\tudp"}}}},
+	}
+
+	var b bytes.Buffer
+	printTSV(&b, sections)
+
+	want := []string{
+		"Section\tName\tType\tNo.\tService",
+		"belongs_to\tweb1\thost\t\t",
+		"access_to\tweb out\t\t1\thttps;dns udp",
+	}
+	if got := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+type reachReport struct {
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Reachable   bool      `json:"reachable"`
+	Rules       []ruleRow `json:"rules"`
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// Only enabled accept rules open a path
+func findReachable(src, dst *checkpoint.Node, allObjects map[string]*checkpoint.Node, rules []checkpoint.ACLRule) reachReport {
+	connecting := checkpoint.Reachable(src, dst, allObjects, acceptingOnly(enabledOnly(rules), allObjects), &hooks)
+
+	return reachReport{
+		Source:      src.Name,
+		Destination: dst.Name,
+		Reachable:   len(connecting) != 0,
+		Rules:       buildRows(connecting, allObjects),
+	}
+}
+
+func printReachability(r reachReport, format string) {
+	if format == "json" {
+		b, err := marshalJSON(topJSON(r))
+		check(err)
+
+		fmt.Fprintln(out, string(b))
+		return
+	}
+
+	s := newReport(r.Source).ruleSection("reachable", r.Source+"->"+r.Destination, r.Rules)
+	printSection(format, s, r)
+
+	if textFormat(format) {
+		fmt.Fprintf(out, "\n%s can reach %s: %s\n", r.Source, r.Destination, yesNo(r.Reachable))
+	}
+}
+
+// Names have to pick out a single object, there is no -uid equivalent for the matrix
+func uniqueName(namesMap map[string][]string, allObjects map[string]*checkpoint.Node, name string) *checkpoint.Node {
+	keys := namesMap[name]
+	switch len(keys) {
+	case 0:
+		log.Fatalf("Object %s not found", name)
+	case 1:
+		return allObjects[keys[0]]
+	}
+
+	var uids []string
+	for _, key := range keys {
+		uids = append(uids, allObjects[key].Uid)
+	}
+	log.Fatalf("Object %s is ambiguous, it is used by %s", name, strings.Join(uids, ", "))
+
+	return nil
+}
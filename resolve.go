@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+type resolution struct {
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	UID         string            `json:"uid"`
+	Fields      map[string]string `json:"fields"`
+	MemberOf    []searchRow       `json:"member_of"`
+	ContainedBy []searchRow       `json:"contained_by"`
+	Raw         json.RawMessage   `json:"raw"`
+
+	//Fields in the order they are shown
+	fields [][2]string
+}
+
+// Networks and address ranges n is linked to that contain it
+func containedBy(n *checkpoint.Node) (containers []*checkpoint.Node) {
+	seen := make(map[*checkpoint.Node]bool)
+	for _, e := range n.Edges {
+		other := e.End
+		if other == n {
+			other = e.Start
+		}
+
+		if e.Method != "Di" || seen[other] || (other.Type != "network" && other.Type != "address-range") || !other.Contains(n) {
+			continue
+		}
+
+		seen[other] = true
+		containers = append(containers, other)
+	}
+
+	return
+}
+
+// The object as it is in the export, the last one when the uid is duplicated as that is the one loaded
+func rawObject(objectSets [][]json.RawMessage, key string) (raw json.RawMessage) {
+	for _, set := range objectSets {
+		for _, v := range set {
+			var header struct {
+				Uid    string
+				Domain checkpoint.DomainName
+			}
+			if json.Unmarshal(v, &header) == nil && checkpoint.ObjectKey(header.Domain, header.Uid) == key {
+				raw = v
+			}
+		}
+	}
+
+	return
+}
+
+func resolveObject(n *checkpoint.Node, allObjects map[string]*checkpoint.Node, objectSets [][]json.RawMessage) resolution {
+	r := resolution{Name: n.Name, Type: n.Type, UID: n.Uid, Fields: make(map[string]string), MemberOf: []searchRow{}, ContainedBy: []searchRow{}}
+
+	r.fields = objectDetails(n).Fields
+	for _, field := range r.fields {
+		r.Fields[field[0]] = field[1]
+	}
+
+	row := func(n *checkpoint.Node) searchRow {
+		return searchRow{Name: n.Name, Type: n.Type, Comment: objectExtra(n, allObjects), UID: n.Uid}
+	}
+
+	for _, g := range checkpoint.MemberOf(n) {
+		r.MemberOf = append(r.MemberOf, row(g))
+	}
+
+	for _, c := range containedBy(n) {
+		r.ContainedBy = append(r.ContainedBy, row(c))
+	}
+
+	r.Raw = rawObject(objectSets, n.Key())
+
+	return r
+}
+
+func printResolution(r resolution, format string) {
+	if format == "json" {
+		b, err := marshalJSON(topJSON(r))
+		check(err)
+
+		fmt.Fprintln(out, string(b))
+		return
+	}
+
+	details := section{Key: "object", Title: r.Name, Headers: []string{"Field", "Value"}}
+	for _, field := range r.fields {
+		details.Rows = append(details.Rows, [][]string{cell(field[0]), cell(field[1])})
+	}
+
+	list := func(key, title string, rows []searchRow) section {
+		s := section{Key: key, Title: title, Spaced: true, Headers: []string{"Name", "Type", "Extra", "UID"}}
+		for _, row := range rows {
+			s.Rows = append(s.Rows, [][]string{cell(row.Name), cell(row.Type), cell(row.Comment), cell(row.UID)})
+		}
+		return s
+	}
+
+	sections := []section{
+		details,
+		list("member_of", r.Name+" Member Of", r.MemberOf),
+		list("contained_by", r.Name+" Contained By", r.ContainedBy),
+	}
+
+	switch format {
+	case "csv":
+		printCSV(out, sections)
+		return
+	case "tsv":
+		printTSV(out, sections)
+		return
+	case "markdown":
+		printMarkdown(out, sections)
+	default:
+		printTables(sections)
+	}
+
+	if r.Raw == nil {
+		return
+	}
+
+	var indented bytes.Buffer
+	check(json.Indent(&indented, r.Raw, "", "\t"))
+
+	if format == "markdown" {
+		fmt.Fprintf(out, "\n```json\n%s\n```\n", indented.String())
+		return
+	}
+
+	fmt.Fprintf(out, "\nRaw JSON\n%s\n", indented.String())
+}
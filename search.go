@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+func sortedKeys(allObjects map[string]*checkpoint.Node) []string {
+	keys := make([]string, 0, len(allObjects))
+	for key := range allObjects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Number of addresses an object covers, so the most specific container can be picked
+func rangeSize(n *checkpoint.Node, ip net.IP) *big.Int {
+	if n.Type == "address-range" {
+		first, last := new(big.Int).SetBytes(net.ParseIP(n.RangeFirst).To16()), new(big.Int).SetBytes(net.ParseIP(n.RangeLast).To16())
+		return new(big.Int).Add(new(big.Int).Sub(last, first), big.NewInt(1))
+	}
+
+	for _, r := range n.Ranges() {
+		if r.Contains(ip) {
+			ones, bits := r.Mask.Size()
+			return new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+		}
+	}
+
+	return nil
+}
+
+// A host with the address wins, otherwise the smallest network or address range containing it
+func findByIP(allObjects map[string]*checkpoint.Node, ip net.IP) *checkpoint.Node {
+	probe := &checkpoint.Node{IPv4: ip.String()}
+	if ip.To4() == nil {
+		probe = &checkpoint.Node{IPv6: ip.String()}
+	}
+
+	var best *checkpoint.Node
+	var bestSize *big.Int
+	for _, key := range sortedKeys(allObjects) {
+		n := allObjects[key]
+		switch n.Type {
+		case "host":
+			for _, address := range n.Addresses() {
+				if address.Equal(ip) {
+					return n
+				}
+			}
+		case "network", "address-range":
+			if !n.Contains(probe) {
+				continue
+			}
+
+			if size := rangeSize(n, ip); best == nil || size.Cmp(bestSize) < 0 {
+				best, bestSize = n, size
+			}
+		}
+	}
+
+	return best
+}
+
+// Keys of objects whose name starts with prefix ignoring case, sorted by name
+func prefixMatches(namesMap map[string][]string, prefix string) (keys []string) {
+	prefix = strings.ToLower(prefix)
+
+	var names []string
+	for name := range namesMap {
+		if strings.HasPrefix(strings.ToLower(name), prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		keys = append(keys, namesMap[name]...)
+	}
+
+	return
+}
+
+type searchRow struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Comment string `json:"comment"`
+	UID     string `json:"uid"`
+}
+
+// Case insensitive substring match on names and comments, e.g ticket numbers kept in comments
+func searchObjects(allObjects map[string]*checkpoint.Node, substr string) (keys []string, rows []searchRow) {
+	substr = strings.ToLower(substr)
+
+	rows = []searchRow{}
+	for _, key := range sortedKeys(allObjects) {
+		n := allObjects[key]
+		if strings.Contains(strings.ToLower(n.Name), substr) || strings.Contains(strings.ToLower(n.Comments), substr) {
+			keys = append(keys, key)
+			rows = append(rows, searchRow{Name: n.Name, Type: n.Type, Comment: strings.TrimSpace(n.Comments), UID: n.Uid})
+		}
+	}
+
+	return
+}
+
+func printSearch(substr string, rows []searchRow, format string) {
+	s := section{Key: "search", Title: "Objects matching " + substr, Headers: []string{"Name", "Type", "Comment", "UID"}}
+	for _, row := range rows {
+		s.Rows = append(s.Rows, [][]string{cell(row.Name), cell(row.Type), cell(row.Comment), cell(row.UID)})
+	}
+
+	printSection(format, s, rows)
+}
+
+// Stand in network for -cidr, linked to the hosts inside it and the networks and address ranges overlapping it.
+// Only its own edges are added, so the rest of the graph doesn't see it
+func cidrNode(allObjects map[string]*checkpoint.Node, cidr *net.IPNet) *checkpoint.Node {
+	n := &checkpoint.Node{Uid: "cidr:" + cidr.String(), Name: cidr.String(), Type: "network"}
+
+	ones, _ := cidr.Mask.Size()
+	if cidr.IP.To4() != nil {
+		n.SubnetAddress, n.MaskLength = cidr.IP.String(), ones
+	} else {
+		n.Subnet6, n.MaskLength6 = cidr.IP.String(), ones
+	}
+
+	first, last := cidr.IP.To16(), lastAddress(cidr).To16()
+	for _, key := range sortedKeys(allObjects) {
+		other := allObjects[key]
+
+		overlaps := false
+		switch other.Type {
+		case "host":
+			overlaps = n.Contains(other)
+		case "network":
+			for _, r := range other.Ranges() {
+				overlaps = overlaps || r.Contains(cidr.IP) || cidr.Contains(r.IP)
+			}
+		case "address-range":
+			rangeFirst, rangeLast := net.ParseIP(other.RangeFirst), net.ParseIP(other.RangeLast)
+			overlaps = rangeFirst != nil && rangeLast != nil && bytes.Compare(rangeFirst.To16(), last) <= 0 && bytes.Compare(rangeLast.To16(), first) >= 0
+		}
+
+		if overlaps {
+			n.Edges = append(n.Edges, &checkpoint.Edge{Start: n, End: other, Method: "Di"})
+		}
+	}
+
+	return n
+}
+
+func lastAddress(cidr *net.IPNet) net.IP {
+	last := make(net.IP, len(cidr.IP))
+	for i := range cidr.IP {
+		last[i] = cidr.IP[i] | ^cidr.Mask[i]
+	}
+
+	return last
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+type serviceFilter struct {
+	protocol string
+	//Negative when any port matches
+	port int
+}
+
+func parseServiceFilter(value string) (f serviceFilter, err error) {
+	parts := strings.SplitN(strings.ToLower(strings.TrimSpace(value)), "/", 2)
+	f.protocol, f.port = parts[0], -1
+
+	if len(parts) == 2 {
+		f.port, err = strconv.Atoi(parts[1])
+		if err != nil || f.port < 0 || f.port > 65535 {
+			return f, fmt.Errorf("Invalid port in service filter %s", value)
+		}
+	}
+
+	if f.protocol == "" {
+		return f, fmt.Errorf("Invalid service filter %s", value)
+	}
+
+	return f, nil
+}
+
+// service-tcp, service-udp, service-icmp and so on
+func serviceProtocol(serv *checkpoint.Node) string {
+	return strings.TrimPrefix(strings.ToLower(serv.Type), "service-")
+}
+
+// Service groups should only hold services, anything else in one is a data error
+func isService(serv *checkpoint.Node) bool {
+	return strings.HasPrefix(serv.Type, "service-") || isApplication(serv) || checkpoint.IsAnyObject(serv)
+}
+
+// Layer 7 application objects (application-site, application-site-category and their groups)
+func isApplication(serv *checkpoint.Node) bool {
+	return strings.HasPrefix(serv.Type, "application-site")
+}
+
+// Any allows every service, so it always matches
+func (f serviceFilter) matches(serv *checkpoint.Node) bool {
+	if checkpoint.IsAnyObject(serv) {
+		return true
+	}
+
+	if serviceProtocol(serv) != f.protocol {
+		return false
+	}
+
+	if f.port < 0 {
+		return true
+	}
+
+	return serv.PortLow <= f.port && f.port <= serv.PortHigh
+}
+
+// Leaf services of the uids, service groups are flattened and each only once so cycles terminate
+func expandServices(uids []string, allObjects map[string]*checkpoint.Node, expanded map[string]bool) (services []*checkpoint.Node) {
+	for _, uid := range uids {
+		serv := checkpoint.Lookup(allObjects, uid)
+		if expanded[serv.Key()] {
+			continue
+		}
+		expanded[serv.Key()] = true
+
+		if serv.Type == "service-group" {
+			services = append(services, expandServices(serv.Members, allObjects, expanded)...)
+			continue
+		}
+
+		services = append(services, serv)
+	}
+
+	return
+}
+
+// Negated services allow everything but their objects, so those rules match when none of the services do
+func withService(rules []checkpoint.ACLRule, allObjects map[string]*checkpoint.Node, f serviceFilter) (matching []checkpoint.ACLRule) {
+	for _, acl := range rules {
+		listed := false
+		for _, serv := range expandServices(acl.Service, allObjects, make(map[string]bool)) {
+			if f.matches(serv) {
+				listed = true
+				break
+			}
+		}
+
+		if listed == acl.ServiceNegate {
+			logSkipped(acl, "no service matches -service")
+			continue
+		}
+
+		matching = append(matching, acl)
+	}
+
+	return
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+const serviceExport = `[
+	{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+	{"uid": "s1", "name": "https", "type": "service-tcp", "port": "443"},
+	{"uid": "sg1", "name": "web-svcs", "type": "service-group", "members": ["https", "gone"]},
+	{"uid": "acc", "name": "Accept", "type": "RulebaseAction"},
+	{"uid": "any", "name": "Any", "type": "CpmiAnyObject"}
+]`
+
+// Service column of a rule from web1 allowing service
+func serviceColumn(t *testing.T, export, service string) []string {
+	t.Helper()
+
+	objects := testObjects(t, export)
+	rows := buildRows([]checkpoint.ACLRule{testRule(1, "h1", "", service)}, objects)
+
+	return rows[0].Service
+}
+
+func TestServiceGroupMissingMember(t *testing.T) {
+	got := strings.Join(serviceColumn(t, serviceExport, "sg1"), "\n")
+
+	for _, want := range []string{"web-svcs:https:service-tcp:443", "web-svcs:<missing:gone>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %s in the services, got %q", want, got)
+		}
+	}
+}
+
+func TestServicesWithoutPort(t *testing.T) {
+	export := `[
+		{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+		{"uid": "o1", "name": "gre", "type": "service-other"},
+		{"uid": "a1", "name": "Facebook", "type": "application-site"},
+		{"uid": "s1", "name": "https", "type": "service-tcp", "port": "443"},
+		{"uid": "any", "name": "Any", "type": "CpmiAnyObject"}
+	]`
+
+	tests := []struct {
+		service string
+		want    string
+	}{
+		{service: "o1", want: "gre:service-other"},
+		{service: "a1", want: "Facebook:application"},
+		{service: "s1", want: "https:service-tcp:443"},
+		{service: "any", want: "ANY"},
+	}
+
+	for _, test := range tests {
+		got := serviceColumn(t, export, test.service)
+		if len(got) != 1 || got[0] != test.want {
+			t.Errorf("Expected %s, got %v", test.want, got)
+		}
+	}
+}
+
+func TestServiceGroupNonServiceMember(t *testing.T) {
+	export := `[
+		{"uid": "h1", "name": "web1", "type": "host", "ipv4-address": "10.0.0.1"},
+		{"uid": "h2", "name": "db1", "type": "host", "ipv4-address": "10.0.1.1"},
+		{"uid": "s1", "name": "https", "type": "service-tcp", "port": "443"},
+		{"uid": "sg1", "name": "web-svcs", "type": "service-group", "members": ["s1", "h2"]},
+		{"uid": "any", "name": "Any", "type": "CpmiAnyObject"}
+	]`
+
+	want := []string{"web-svcs:https:service-tcp:443", "web-svcs:db1 (⚠ non-service member host)"}
+	if got := serviceColumn(t, export, "sg1"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
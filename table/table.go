@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"unicode/utf8"
 )
 
 type value struct {
@@ -19,13 +20,78 @@ type Table struct {
 	line          [][]value
 	cellMaxWidth  []int
 	lineMaxHeight []int
+	truncateAt    int
+	footer        []value
+	footerHeight  int
+
+	colorMode ColorMode
+	classify  func(values []string) string
+	lineColor []string
+}
+
+type ColorMode int
+
+const (
+	//Color only when writing to a terminal
+	ColorAuto ColorMode = iota
+	ColorAlways
+	ColorNever
+)
+
+const (
+	Red   = "\033[31m"
+	Green = "\033[32m"
+	reset = "\033[0m"
+)
+
+func ParseColorMode(mode string) (ColorMode, error) {
+	switch mode {
+	case "auto":
+		return ColorAuto, nil
+	case "always":
+		return ColorAlways, nil
+	case "never":
+		return ColorNever, nil
+	}
+
+	return ColorNever, fmt.Errorf("Unknown color mode %s", mode)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (m ColorMode) enabled(w io.Writer) bool {
+	return m == ColorAlways || (m == ColorAuto && isTerminal(w))
 }
 
-func makeValue(rn string) (val value) {
-	val.parts = strings.Split(rn, "\n")
-	for _, n := range val.parts {
-		if len(n) > val.longest {
-			val.longest = len(n)
+const ellipsis = "..."
+
+// Line endings from Windows and tabs would throw the columns out, so they become plain newlines and spaces
+var normalise = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\t", "    ")
+
+func makeValue(rn string, truncateAt int) (val value) {
+	val.parts = strings.Split(normalise.Replace(rn), "\n")
+	for i, n := range val.parts {
+		if truncateAt > 0 && utf8.RuneCountInString(n) > truncateAt {
+			runes := []rune(n)
+			if truncateAt > len(ellipsis) {
+				n = string(runes[:truncateAt-len(ellipsis)]) + ellipsis
+			} else {
+				n = string(runes[:truncateAt])
+			}
+			val.parts[i] = n
+		}
+
+		//Padding counts runes, so widths have to as well
+		if length := utf8.RuneCountInString(n); length > val.longest {
+			val.longest = length
 		}
 	}
 	return
@@ -63,7 +129,7 @@ func (t *Table) AddValues(vals ...string) error {
 
 	var line []value
 	for _, v := range vals {
-		line = append(line, makeValue(v))
+		line = append(line, makeValue(v, t.truncateAt))
 	}
 
 	err := t.updateMax(line)
@@ -71,61 +137,119 @@ func (t *Table) AddValues(vals ...string) error {
 		return err
 	}
 
+	color := ""
+	if t.classify != nil && len(t.line) != 0 {
+		color = t.classify(vals)
+	}
+
 	t.line = append(t.line, line)
+	t.lineColor = append(t.lineColor, color)
+
+	return nil
+}
+
+// Totals or similar printed below the rows, set off by a double line. Its values count towards the column widths
+func (t *Table) SetFooter(vals ...string) error {
+	if len(vals) != t.rows {
+		return fmt.Errorf("Error footer has %d values for %d columns", len(vals), t.rows)
+	}
+
+	var line []value
+	for _, v := range vals {
+		line = append(line, makeValue(v, t.truncateAt))
+	}
+
+	if err := t.updateMax(line); err != nil {
+		return err
+	}
+
+	//updateMax records a height for a row, the footer isn't one
+	t.footerHeight = t.lineMaxHeight[len(t.lineMaxHeight)-1]
+	t.lineMaxHeight = t.lineMaxHeight[:len(t.lineMaxHeight)-1]
+	t.footer = line
 
 	return nil
 }
 
-func (t *Table) Print() {
-	t.Fprint(os.Stdout)
+// Lines of values added after this longer than width are cut short with an ellipsis, 0 disables it
+func (t *Table) SetMaxWidth(width int) {
+	t.truncateAt = width
 }
 
-func (t *Table) Fprint(w io.Writer) {
+// Rows added after this are colored by classify, which returns the color for the row's values or "" for none
+func (t *Table) SetColor(mode ColorMode, classify func(values []string) string) {
+	t.colorMode = mode
+	t.classify = classify
+}
 
-	firstLine := true
+func (t *Table) draw(line []value, height int) (drawnLines []string, max int) {
+	// X Y
+	values := make([][]string, len(line))
+	for x, m := range line {
+		values[x] = m.parts
+	}
 
-	for n, line := range t.line {
-		// X Y
-		values := make([][]string, len(line))
-		for x, m := range line {
-			values[x] = m.parts
-		}
+	for y := 0; y < height; y++ {
 
-		drawnLines := []string{}
-		max := 0
-		for y := 0; y < t.lineMaxHeight[n]; y++ {
-
-			m := "|"
-			for x := 0; x < len(line); x++ {
-				val := ""
-				if len(values[x]) > y {
-					val = values[x][y]
-				}
-				m += fmt.Sprintf(" %-"+fmt.Sprintf("%d", t.cellMaxWidth[x])+"s |", val)
+		m := "|"
+		for x := 0; x < len(line); x++ {
+			val := ""
+			if len(values[x]) > y {
+				val = values[x][y]
 			}
+			m += fmt.Sprintf(" %-"+fmt.Sprintf("%d", t.cellMaxWidth[x])+"s |", val)
+		}
 
-			if max < len(m) {
-				max = len(m)
-			}
+		if length := utf8.RuneCountInString(m); max < length {
+			max = length
+		}
 
-			drawnLines = append(drawnLines, m)
+		drawnLines = append(drawnLines, m)
 
-		}
+	}
+
+	return
+}
+
+func (t *Table) Print(w io.Writer) {
+
+	firstLine := true
+	colored := t.colorMode.enabled(w)
+
+	for n, line := range t.line {
+		drawnLines, max := t.draw(line, t.lineMaxHeight[n])
 
 		if firstLine {
 			firstLine = false
 			fmt.Fprintf(w, "%"+fmt.Sprintf("%d", max/2)+"s\n", t.name)
 
-			fmt.Println(seperator(max))
+			fmt.Fprintln(w, seperator(max))
 		}
 
 		for _, l := range drawnLines {
-			fmt.Println(l)
+			if colored && t.lineColor[n] != "" {
+				l = t.lineColor[n] + l + reset
+			}
+
+			fmt.Fprintln(w, l)
 		}
 
-		fmt.Println(seperator(max))
+		//A double line sets the footer off from the last row
+		if n == len(t.line)-1 && t.footer != nil {
+			fmt.Fprintln(w, strings.Repeat("=", max))
+		} else {
+			fmt.Fprintln(w, seperator(max))
+		}
 
 	}
+
+	if t.footer != nil {
+		drawnLines, max := t.draw(t.footer, t.footerHeight)
+		for _, l := range drawnLines {
+			fmt.Fprintln(w, l)
+		}
+		fmt.Fprintln(w, seperator(max))
+	}
 }
 
 func seperator(i int) (out string) {
@@ -140,7 +264,7 @@ func NewTable(name string, rowNames ...string) (t Table, err error) {
 
 	var line []value
 	for _, name := range rowNames {
-		line = append(line, makeValue(name))
+		line = append(line, makeValue(name, 0))
 	}
 
 	t.rows = len(line)
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/NHAS/checkpoint-audit/checkpoint"
+)
+
+// Time objects restrict when a rule applies, e.g "business-hours: 08:00-17:00"
+func describeTime(t *checkpoint.Node) string {
+	if t.Type == checkpoint.MissingType {
+		return t.Name
+	}
+
+	var parts []string
+
+	if !t.StartNow && t.Start.Iso8601 != "" {
+		parts = append(parts, "from "+t.Start.Iso8601)
+	}
+
+	if !t.EndNever && t.End.Iso8601 != "" {
+		parts = append(parts, "until "+t.End.Iso8601)
+	}
+
+	for _, h := range t.HoursRanges {
+		if h.Enabled {
+			parts = append(parts, h.From+"-"+h.To)
+		}
+	}
+
+	if len(parts) == 0 {
+		return t.Name
+	}
+
+	return t.Name + ": " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Set at build time with -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD)"
+var (
+	version = ""
+	commit  = ""
+)
+
+// Builds without ldflags fall back to the module version, which go install sets from the tag
+func versionString() string {
+	v := version
+	if v == "" {
+		v = "devel"
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+			v = info.Main.Version
+		}
+	}
+
+	if commit == "" {
+		return v
+	}
+
+	return fmt.Sprintf("%s (%s)", v, commit)
+}